@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"fmt"
 	"os"
 
 	"github.com/c-a-ray/dkit/internal/core"
@@ -14,39 +15,87 @@ func addCmpCmd(parent *cobra.Command, cfg *core.Config) {
 		Short: "Compare files, directories, and archives",
 	}
 
-	cmpCmd.AddCommand(newCmpZipsCmd(cfg))
+	cmpCmd.AddCommand(newCmpArchivesCmd(cfg,
+		"zips <file_a.zip> <file_b.zip>",
+		"Compare two ZIP archives and their contents"))
+	cmpCmd.AddCommand(newCmpArchivesCmd(cfg,
+		"tars <file_a.tar[.gz]> <file_b.tar[.gz]>",
+		"Compare two tar archives (optionally gzipped) and their contents"))
+	cmpCmd.AddCommand(newCmpArchivesCmd(cfg,
+		"dirs <dir_a> <dir_b>",
+		"Compare two directory trees and their contents"))
 
 	parent.AddCommand(cmpCmd)
 }
 
-func newCmpZipsCmd(cfg *core.Config) *cobra.Command {
+// newCmpArchivesCmd builds one of the archive comparison subcommands; each
+// accepts any mix of ZIP, tar, and directory arguments, detected per path
+func newCmpArchivesCmd(cfg *core.Config, use, short string) *cobra.Command {
 	var summaryOnly bool
 	var ignoreMissing bool
+	var trustCRC bool
+	var recursive bool
+	var maxDepth int
+	var paths ops.PathMapOpts
+	var findRenames bool
+	var renameThreshold float64
+	var metadata bool
+	var diff ops.DiffOpts
+	var color string
 
 	cmd := &cobra.Command{
-		Use:   "zips <file_a.zip> <file_b.zip>",
-		Short: "Compare two ZIP archives and their contents",
-		Args:  cobra.ExactArgs(2),
+		Use:   use,
+		Short: short,
+		Long: short + `
+
+Either side may be a ZIP archive, a tar archive (optionally gzipped), or a
+directory, so a re-packaged delivery can be checked against the original
+or against an extracted copy.`,
+		Args: cobra.ExactArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			zipA := args[0]
-			zipB := args[1]
-
-			opts := ops.ZipCmpOpts{
-				ZipA:          zipA,
-				ZipB:          zipB,
-				Quiet:         cfg.Quiet,
-				SummaryOnly:   summaryOnly,
-				IgnoreMissing: ignoreMissing,
-				Config:        cfg,
+			pathA := args[0]
+			pathB := args[1]
+
+			if maxDepth < 0 {
+				return fmt.Errorf("--max-depth must be >= 0, got %d", maxDepth)
+			}
+
+			if renameThreshold < 0 || renameThreshold > 1 {
+				return fmt.Errorf("--rename-threshold must be in [0, 1], got %v", renameThreshold)
 			}
 
-			res, err := ops.CompareZips(opts)
+			useColor, err := parseColorFlag(color)
 			if err != nil {
 				return err
 			}
+			diff.Color = useColor
 
-			// Exit with code 2 if there are differences
-			if res.Different > 0 || (!ignoreMissing && (res.OnlyInA > 0 || res.OnlyInB > 0)) {
+			opts := ops.ArchiveCmpOpts{
+				PathA:           pathA,
+				PathB:           pathB,
+				Quiet:           cfg.Quiet,
+				SummaryOnly:     summaryOnly,
+				IgnoreMissing:   ignoreMissing,
+				TrustCRC:        trustCRC,
+				Recursive:       recursive,
+				MaxDepth:        maxDepth,
+				Paths:           paths,
+				FindRenames:     findRenames,
+				RenameThreshold: renameThreshold,
+				Metadata:        metadata,
+				Diff:            diff,
+				Config:          cfg,
+			}
+
+			res, err := ops.CompareArchives(opts)
+			if err != nil {
+				return err
+			}
+
+			// Exit with code 2 if there are differences; pure renames count
+			// as missing files
+			if res.Different > 0 || res.RenamedModified > 0 || res.MetadataDiffs > 0 ||
+				(!ignoreMissing && (res.OnlyInA > 0 || res.OnlyInB > 0 || res.Renamed > 0)) {
 				os.Exit(2)
 			}
 
@@ -56,6 +105,42 @@ func newCmpZipsCmd(cfg *core.Config) *cobra.Command {
 
 	cmd.Flags().BoolVarP(&summaryOnly, "summary-only", "s", false, "show only summary, skip detailed diffs")
 	cmd.Flags().BoolVar(&ignoreMissing, "ignore-missing", false, "don't error if files are missing from one archive")
+	cmd.Flags().BoolVar(&trustCRC, "trust-crc", false, "treat members with matching size and CRC-32 as identical without reading them")
+	cmd.Flags().BoolVarP(&recursive, "recursive", "r", false, "descend into nested ZIP archives and compare their members")
+	cmd.Flags().IntVar(&maxDepth, "max-depth", 5, "maximum nesting depth for --recursive")
+	cmd.Flags().StringArrayVar(&paths.Include, "include", nil, "only compare members matching this glob (repeatable; ** spans directories)")
+	cmd.Flags().StringArrayVar(&paths.Exclude, "exclude", nil, "skip members matching this glob (repeatable; ** spans directories)")
+	cmd.Flags().IntVar(&paths.StripComponents, "strip-components", 0, "drop this many leading path segments before pairing members")
+	cmd.Flags().StringArrayVar(&paths.Rewrites, "rewrite", nil, "rewrite member paths before pairing, as REGEX=>REPLACEMENT (repeatable)")
+	cmd.Flags().BoolVar(&paths.IgnoreCase, "ignore-case", false, "pair member names case-insensitively")
+	cmd.Flags().BoolVarP(&findRenames, "find-renames", "M", false, "pair renamed or moved members by content hash and text similarity")
+	cmd.Flags().Float64Var(&renameThreshold, "rename-threshold", 0.5, "minimum line similarity (0-1) for --find-renames to pair text members (0 for exact content matches only)")
+	cmd.Flags().BoolVar(&metadata, "metadata", false, "also compare modification times, permissions, compression methods, and comments")
+	addDiffFlags(cmd, &diff, &color)
 
 	return cmd
 }
+
+// addDiffFlags registers the flags controlling text diff previews
+func addDiffFlags(cmd *cobra.Command, diff *ops.DiffOpts, color *string) {
+	cmd.Flags().IntVar(&diff.Context, "context", 3, "lines of context around each diff hunk")
+	cmd.Flags().IntVar(&diff.MaxHunks, "max-hunks", 10, "maximum diff hunks to show per file (0 for no limit)")
+	cmd.Flags().BoolVar(&diff.IgnoreSpace, "ignore-space", false, "ignore whitespace when comparing text lines")
+	cmd.Flags().BoolVar(&diff.IgnoreEOL, "ignore-eol", false, "treat CRLF and LF line endings as equal")
+	cmd.Flags().StringVar(color, "color", "auto", "colorize diffs: auto, always, or never")
+}
+
+// parseColorFlag resolves a --color value, where auto enables color only
+// when diffs are written to a terminal
+func parseColorFlag(s string) (bool, error) {
+	switch s {
+	case "auto":
+		return core.IsTerminal(os.Stderr), nil
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	default:
+		return false, fmt.Errorf("--color must be auto, always, or never, got %q", s)
+	}
+}
@@ -21,6 +21,8 @@ func addColCmd(parent *cobra.Command, cfg *core.Config) {
 	colCmd.AddCommand(newColFirstCmd(cfg))
 	colCmd.AddCommand(newColDupKeyCmd(cfg))
 	colCmd.AddCommand(newColListCmd(cfg))
+	colCmd.AddCommand(newColStatsCmd(cfg))
+	colCmd.AddCommand(newColDriftCmd(cfg))
 
 	parent.AddCommand(colCmd)
 }
@@ -75,10 +77,17 @@ func newColValsCmd(cfg *core.Config) *cobra.Command {
 	var nullTok string
 	var fixed string
 	var whenFlags []string
+	var top, minCount int
+	var pct, totals bool
+	var byFile bool
+	var newSince string
+	var approx, spill bool
+	var spillDir string
+	var maxValues int
 
 	cmd := &cobra.Command{
-		Use:   "vals <uniq|freq> <COL> [files...]",
-		Short: "Unique values or value counts for a column",
+		Use:   "vals <uniq|freq> <COL[,COL...]> [files...]",
+		Short: "Unique values or value counts for a column or combination of columns",
 		Args:  cobra.MinimumNArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			sub := args[0]
@@ -92,6 +101,9 @@ func newColValsCmd(cfg *core.Config) *cobra.Command {
 			if len(files) == 0 {
 				return fmt.Errorf("no files")
 			}
+			if (approx || spill || spillDir != "") && maxValues <= 1 {
+				return fmt.Errorf("--max-values must be greater than 1 with --approx or --spill, got %d", maxValues)
+			}
 
 			list, err := core.ExpandFiles(files)
 			if err != nil {
@@ -104,9 +116,18 @@ func newColValsCmd(cfg *core.Config) *cobra.Command {
 			}
 
 			opt := ops.ValsOpts{
-				Column:    col,
 				Mode:      ops.ValsUniq,
 				NullToken: nullTok,
+				Top:       top,
+				MinCount:  minCount,
+				Pct:       pct,
+				Totals:    totals,
+				ByFile:    byFile,
+				NewSince:  newSince,
+				Approx:    approx,
+				Spill:     spill || spillDir != "",
+				SpillDir:  spillDir,
+				MaxValues: maxValues,
 				Filter:    filter,
 				Config:    cfg,
 			}
@@ -116,11 +137,15 @@ func newColValsCmd(cfg *core.Config) *cobra.Command {
 			}
 
 			if fixed != "" {
-				var s, e int
-				if _, err := fmt.Sscanf(fixed, "%d:%d", &s, &e); err != nil {
-					return fmt.Errorf("--fixed-width expects START:END, got %q", fixed)
+				// A single unnamed range takes the name of COL
+				opt.Fixed, err = ops.ParseFixedFields(fixed, col)
+				if err != nil {
+					return fmt.Errorf("invalid --fixed-width: %w", err)
 				}
-				opt.FixedStart, opt.FixedEnd = s, e
+			}
+			opt.Columns = ops.SplitColumns(list, col, opt.Fixed, cfg)
+			if len(opt.Columns) == 0 {
+				return fmt.Errorf("no columns given")
 			}
 
 			return ops.ColumnValues(list, opt)
@@ -128,13 +153,29 @@ func newColValsCmd(cfg *core.Config) *cobra.Command {
 	}
 
 	cmd.Flags().StringVar(&nullTok, "null-token", "<EMPTY>", "token to print for empty cells (freq only)")
-	cmd.Flags().StringVar(&fixed, "fixed-width", "", "use fixed-width extraction START:END (1-based)")
-	cmd.Flags().StringArrayVarP(&whenFlags, "when", "w", nil, "filter rows by condition (repeatable, ANDed; use | for OR)")
+	cmd.Flags().StringVar(&fixed, "fixed-width", "", "read fixed-width lines: START:END, or NAME=START:END,... to name fields for COL and --when (1-based characters)")
+	cmd.Flags().StringArrayVarP(&whenFlags, "when", "w", nil, whenUsage)
+	cmd.Flags().IntVar(&top, "top", 0, "show only the N most frequent values (freq only)")
+	cmd.Flags().IntVar(&minCount, "min-count", 0, "show only values seen at least N times (freq only)")
+	cmd.Flags().BoolVar(&pct, "pct", false, "add percent and cumulative percent columns (freq only)")
+	cmd.Flags().BoolVar(&totals, "totals", false, "add a row totalling all values (freq only)")
+	cmd.Flags().BoolVar(&byFile, "by-file", false, "show a value × file matrix of counts")
+	cmd.Flags().StringVar(&newSince, "new-since", "", "show values first seen in files after `FILE`, in input order")
+	cmd.Flags().BoolVar(&approx, "approx", false, "bounded memory: estimate distinct values and top frequencies past --max-values")
+	cmd.Flags().BoolVar(&spill, "spill", false, "bounded memory: count exactly, sorting to temporary files past --max-values")
+	cmd.Flags().StringVar(&spillDir, "spill-dir", "", "directory for --spill temporary files (implies --spill; default system temp)")
+	cmd.Flags().IntVar(&maxValues, "max-values", 1_000_000, "distinct values held in memory with --approx or --spill")
+	cmd.MarkFlagsMutuallyExclusive("approx", "spill")
 
 	return cmd
 }
 
 func newColFirstCmd(cfg *core.Config) *cobra.Command {
+	var n int
+	var last, showLine bool
+	var with string
+	var whenFlags []string
+
 	cmd := &cobra.Command{
 		Use:   "first <COL> [files...]",
 		Short: "Print first non-empty value per file for a column",
@@ -146,20 +187,33 @@ func newColFirstCmd(cfg *core.Config) *cobra.Command {
 			if len(files) == 0 {
 				return fmt.Errorf("no files")
 			}
+			if n < 1 {
+				return fmt.Errorf("-n must be at least 1, got %d", n)
+			}
 
 			list, err := core.ExpandFiles(files)
 			if err != nil {
 				return err
 			}
 
-			n, err := ops.FirstNonEmpty(list, ops.FirstOpts{
-				Column: col,
-				Config: cfg,
+			filter, err := ops.ParseWhenFlags(whenFlags)
+			if err != nil {
+				return fmt.Errorf("invalid --when: %w", err)
+			}
+
+			printed, err := ops.FirstNonEmpty(list, ops.FirstOpts{
+				Column:   col,
+				N:        n,
+				Last:     last,
+				ShowLine: showLine,
+				With:     splitComma(with),
+				Filter:   filter,
+				Config:   cfg,
 			})
 			if err != nil {
 				return err
 			}
-			if n == 0 {
+			if printed == 0 {
 				os.Exit(2)
 			}
 
@@ -167,6 +221,12 @@ func newColFirstCmd(cfg *core.Config) *cobra.Command {
 		},
 	}
 
+	cmd.Flags().IntVarP(&n, "num", "n", 1, "number of distinct non-empty values per file")
+	cmd.Flags().BoolVar(&last, "last", false, "take values from the end of each file")
+	cmd.Flags().BoolVar(&showLine, "show-line", false, "prefix values with their line number")
+	cmd.Flags().StringVar(&with, "with", "", "comma-separated columns to print from the same row")
+	cmd.Flags().StringArrayVarP(&whenFlags, "when", "w", nil, whenUsage)
+
 	return cmd
 }
 
@@ -175,13 +235,17 @@ func newColDupKeyCmd(cfg *core.Config) *cobra.Command {
 	var ignoreCase bool
 	var requireAll bool
 	var nullTok string
+	var similarity string
+	var threshold float64
+	var reverse, failOnTypos bool
+	var maxExamples int
+	var export string
 
 	cmd := &cobra.Command{
-		Use:   "dupkey <KEY> [files...]",
-		Short: "Report keys that map to multiple distinct tuples (e.g., First+Last)",
+		Use:   "dupkey <KEY[,KEY...]> [files...]",
+		Short: "Report keys (one or more columns) that map to multiple distinct tuples (e.g., First+Last)",
 		Args:  cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			key := args[0]
 			files := args[1:]
 			if by == "" {
 				return fmt.Errorf("--by is required (comma-separated columns)")
@@ -193,20 +257,44 @@ func newColDupKeyCmd(cfg *core.Config) *cobra.Command {
 			if err != nil {
 				return err
 			}
+			keys := ops.SplitColumns(list, args[0], nil, cfg)
+			if len(keys) == 0 {
+				return fmt.Errorf("no key columns given")
+			}
+			byCols := splitComma(by)
+			sims, err := ops.ParseFieldSimilarity(similarity, byCols)
+			if err != nil {
+				return fmt.Errorf("invalid --similarity: %w", err)
+			}
+			// 0 means "each method's default" internally, so it cannot be asked for
+			if cmd.Flags().Changed("threshold") && (threshold <= 0 || threshold > 1) {
+				return fmt.Errorf("--threshold must be in (0, 1], got %v", threshold)
+			}
+			if maxExamples < 0 {
+				return fmt.Errorf("--max-examples must be >= 0, got %d", maxExamples)
+			}
+			if reverse && similarity != "" {
+				return fmt.Errorf("--similarity cannot be used with --reverse")
+			}
 			opts := ops.DupKeyOpts{
-				Key:        key,
-				ByColumns:  splitComma(by),
-				IgnoreCase: ignoreCase,
-				RequireAll: requireAll,
-				NullToken:  nullTok,
-				Quiet:      cfg.Quiet,
-				Config:     cfg,
+				Keys:        keys,
+				ByColumns:   byCols,
+				IgnoreCase:  ignoreCase,
+				RequireAll:  requireAll,
+				NullToken:   nullTok,
+				Similarity:  sims,
+				Threshold:   threshold,
+				Reverse:     reverse,
+				MaxExamples: maxExamples,
+				Export:      export,
+				Quiet:       cfg.Quiet,
+				Config:      cfg,
 			}
 			res, err := ops.DupKey(list, opts)
 			if err != nil {
 				return err
 			}
-			if res.ConflictingKeys > 0 {
+			if res.ConflictingKeys > 0 || res.ConflictingTuples > 0 || (failOnTypos && res.TypoKeys > 0) {
 				os.Exit(2)
 			}
 			return nil
@@ -217,6 +305,12 @@ func newColDupKeyCmd(cfg *core.Config) *cobra.Command {
 	cmd.Flags().BoolVar(&ignoreCase, "ignore-case", false, "case-insensitive comparisons")
 	cmd.Flags().BoolVar(&requireAll, "require-all", false, "skip rows where any BY field is empty")
 	cmd.Flags().StringVar(&nullTok, "null-token", "<EMPTY>", "token to substitute for empty BY fields (ignored if --require-all)")
+	cmd.Flags().StringVar(&similarity, "similarity", "", "report keys whose BY-tuples are all near-identical as likely typos: jaro-winkler, levenshtein, soundex, or metaphone for every BY column, or FIELD=METHOD,... to compare only those columns loosely (values without letters always match exactly)")
+	cmd.Flags().Float64Var(&threshold, "threshold", 0, "minimum similarity, above 0 and at most 1, for jaro-winkler and levenshtein (default 0.9 and 0.75)")
+	cmd.Flags().BoolVar(&failOnTypos, "fail-on-typos", false, "exit 2 for likely typos too, not only for conflicts")
+	cmd.Flags().BoolVar(&reverse, "reverse", false, "report BY-tuples that appear under more than one KEY instead (e.g., one person under several MRNs)")
+	cmd.Flags().IntVar(&maxExamples, "max-examples", 3, "file:line locations to show per reported tuple (0 to hide)")
+	cmd.Flags().StringVar(&export, "export", "", "write every row of a reported key (or tuple, with --reverse) to this CSV file, with its file and line")
 
 	return cmd
 }
@@ -224,6 +318,7 @@ func newColDupKeyCmd(cfg *core.Config) *cobra.Command {
 func newColListCmd(cfg *core.Config) *cobra.Command {
 	var sorted, oneline bool
 	var onelineDelim string
+	var perFile, common, diff, counts bool
 
 	cmd := &cobra.Command{
 		Use:   "list [files...]",
@@ -244,6 +339,10 @@ func newColListCmd(cfg *core.Config) *cobra.Command {
 				Sorted:       sorted,
 				OneLine:      oneline,
 				OneLineDelim: string(delim),
+				PerFile:      perFile,
+				Common:       common,
+				Diff:         diff,
+				Counts:       counts,
 				Config:       cfg,
 			})
 		},
@@ -252,10 +351,95 @@ func newColListCmd(cfg *core.Config) *cobra.Command {
 	cmd.Flags().BoolVar(&sorted, "sorted", false, "sort columns alphabetically")
 	cmd.Flags().BoolVar(&oneline, "oneline", false, "print all columns on one line")
 	cmd.Flags().StringVarP(&onelineDelim, "outdelim", "o", "comma", "output delimiter for --oneline (tab, comma, pipe, space, or single char)")
+	cmd.Flags().BoolVar(&perFile, "per-file", false, "print each file's header with column positions")
+	cmd.Flags().BoolVar(&common, "common", false, "only columns present in every file")
+	cmd.Flags().BoolVar(&diff, "diff", false, "only columns missing from at least one file")
+	cmd.Flags().BoolVar(&counts, "counts", false, "show how many files contain each column")
+	cmd.MarkFlagsMutuallyExclusive("per-file", "common", "diff")
+	cmd.MarkFlagsMutuallyExclusive("per-file", "counts")
 
 	return cmd
 }
 
+func newColDriftCmd(cfg *core.Config) *cobra.Command {
+	var sortBy string
+
+	cmd := &cobra.Command{
+		Use:   "drift [files...]",
+		Short: "Show how headers differ across files: presence matrix, signatures, and changes",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			list, err := core.ExpandFiles(args)
+			if err != nil {
+				return err
+			}
+
+			return ops.ColumnDrift(list, ops.DriftOpts{
+				SortBy: sortBy,
+				Config: cfg,
+			})
+		},
+	}
+
+	cmd.Flags().StringVar(&sortBy, "sort", "name", "file order for changes: name, mtime, or args")
+
+	return cmd
+}
+
+func newColStatsCmd(cfg *core.Config) *cobra.Command {
+	var groupBy string
+	var percentiles []float64
+	var exactLimit int
+	var nullTok string
+	var whenFlags []string
+
+	cmd := &cobra.Command{
+		Use:   "stats <COL> [files...]",
+		Short: "Numeric statistics (min/max/mean/median/stddev/percentiles) for a column",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			col := args[0]
+
+			files := args[1:]
+			if len(files) == 0 {
+				return fmt.Errorf("no files")
+			}
+
+			list, err := core.ExpandFiles(files)
+			if err != nil {
+				return err
+			}
+
+			filter, err := ops.ParseWhenFlags(whenFlags)
+			if err != nil {
+				return fmt.Errorf("invalid --when: %w", err)
+			}
+
+			return ops.ColumnStats(list, ops.StatsOpts{
+				Column:      col,
+				GroupBy:     groupBy,
+				Percentiles: percentiles,
+				ExactLimit:  exactLimit,
+				NullToken:   nullTok,
+				Filter:      filter,
+				Config:      cfg,
+			})
+		},
+	}
+
+	cmd.Flags().StringVar(&groupBy, "group-by", "", "report statistics per value of this column")
+	cmd.Flags().Float64SliceVar(&percentiles, "percentiles", []float64{25, 75, 90, 95, 99}, "percentiles to report (0-100, comma-separated)")
+	cmd.Flags().IntVar(&exactLimit, "exact-limit", 1_000_000, "values kept per group for exact quantiles before switching to estimates (0 for no limit)")
+	cmd.Flags().StringVar(&nullTok, "null-token", "<EMPTY>", "group label for empty --group-by cells")
+	cmd.Flags().StringArrayVarP(&whenFlags, "when", "w", nil, whenUsage)
+
+	return cmd
+}
+
+// whenUsage describes the --when filter syntax shared by every command
+const whenUsage = "filter rows by condition (repeatable, ANDed): COL=VAL, COL!=VAL, COL~REGEX, COL!~REGEX, COL is empty, COL not empty; " +
+	"| for OR except inside a regex's (...) or [...], \\| for a literal pipe, \\~ for a ~ in a column name"
+
 func splitComma(s string) []string {
 	parts := strings.Split(s, ",")
 	out := make([]string, 0, len(parts))
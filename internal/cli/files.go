@@ -21,15 +21,34 @@ func addFilesCmd(root *cobra.Command, cfg *core.Config) {
 }
 
 func newFilesWithCmd(cfg *core.Config) *cobra.Command {
-	var ci bool
+	var ci, regex bool
+	var whenFlags []string
+	var count, invert, rows bool
 	cmd := &cobra.Command{
-		Use:   "with <COL> <VALUE> [files...]",
-		Short: "List files where column equals VALUE",
-		Args:  cobra.MinimumNArgs(2),
+		Use:   "with [<COL> <VALUE>] [files...]",
+		Short: "List files with rows where column equals VALUE (or matching --when)",
+		Long: `List files with at least one matching row.
+
+A row matches when COL equals VALUE (or matches it with --regex). With
+--when, all arguments are files and a row matches when every condition holds;
+COL=VALUE and COL~REGEX clauses take the place of the pair.`,
+		Args: cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			col := args[0]
-			val := args[1]
-			files := args[2:]
+			filter, err := ops.ParseWhenFlags(whenFlags)
+			if err != nil {
+				return fmt.Errorf("invalid --when: %w", err)
+			}
+			var col, val string
+			files := args
+			if !filter.IsEmpty() && (regex || ci) {
+				return fmt.Errorf("--regex and --case-insensitive apply to <COL> <VALUE>; with --when use COL~REGEX (prefix (?i) to ignore case)")
+			}
+			if filter.IsEmpty() {
+				if len(args) < 2 {
+					return fmt.Errorf("need <COL> <VALUE> or --when")
+				}
+				col, val, files = args[0], args[1], args[2:]
+			}
 			if len(files) == 0 {
 				return fmt.Errorf("no files")
 			}
@@ -40,7 +59,12 @@ func newFilesWithCmd(cfg *core.Config) *cobra.Command {
 			n, err := ops.FilesWith(list, ops.FilesWithOpts{
 				Column:          col,
 				Value:           val,
+				Regex:           regex,
 				CaseInsensitive: ci,
+				Filter:          filter,
+				Count:           count,
+				Invert:          invert,
+				Rows:            rows,
 				Config:          cfg,
 			})
 			if err != nil {
@@ -52,6 +76,12 @@ func newFilesWithCmd(cfg *core.Config) *cobra.Command {
 			return nil
 		},
 	}
-	cmd.Flags().BoolVar(&ci, "case-insensitive", false, "case-insensitive match")
+	cmd.Flags().BoolVar(&ci, "case-insensitive", false, "case-insensitive match of VALUE")
+	cmd.Flags().BoolVar(&regex, "regex", false, "treat VALUE as a regular expression (unanchored)")
+	cmd.Flags().StringArrayVarP(&whenFlags, "when", "w", nil, whenUsage)
+	cmd.Flags().BoolVar(&count, "count", false, "print each file with its number of matching rows")
+	cmd.Flags().BoolVar(&invert, "invert", false, "list files with no matching rows, including empty files and files without the column")
+	cmd.Flags().BoolVar(&rows, "rows", false, "print matching rows as path:line: record")
+	cmd.MarkFlagsMutuallyExclusive("count", "invert", "rows")
 	return cmd
 }
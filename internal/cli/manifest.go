@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"os"
+
+	"github.com/c-a-ray/dkit/internal/core"
+	"github.com/c-a-ray/dkit/internal/ops"
+	"github.com/spf13/cobra"
+)
+
+func addManifestCmd(root *cobra.Command, cfg *core.Config) {
+	manifestCmd := &cobra.Command{
+		Use:   "manifest",
+		Short: "Record and verify the contents of a delivery",
+	}
+
+	manifestCmd.AddCommand(newManifestCreateCmd(cfg))
+	manifestCmd.AddCommand(newManifestVerifyCmd(cfg))
+
+	root.AddCommand(manifestCmd)
+}
+
+func newManifestCreateCmd(cfg *core.Config) *cobra.Command {
+	var out string
+	var recursive bool
+	var maxDepth int
+
+	cmd := &cobra.Command{
+		Use:   "create <zip|tar|dir>",
+		Short: "Write a JSON manifest (path, size, SHA-256, rows, header) of an archive or directory",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			_, err := ops.CreateManifest(ops.ManifestOpts{
+				Path:      args[0],
+				Output:    out,
+				Recursive: recursive,
+				MaxDepth:  maxDepth,
+				Quiet:     cfg.Quiet,
+				Config:    cfg,
+			})
+			return err
+		},
+	}
+
+	cmd.Flags().StringVarP(&out, "out", "o", "", "write the manifest to this file instead of stdout")
+	cmd.Flags().BoolVarP(&recursive, "recursive", "r", false, "descend into nested ZIP archives")
+	cmd.Flags().IntVar(&maxDepth, "max-depth", 5, "maximum nesting depth for --recursive")
+
+	return cmd
+}
+
+func newManifestVerifyCmd(cfg *core.Config) *cobra.Command {
+	var recursive bool
+	var maxDepth int
+	var ignoreExtra bool
+
+	cmd := &cobra.Command{
+		Use:   "verify <manifest.json> <zip|tar|dir>",
+		Short: "Check an archive or directory against a manifest",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			res, err := ops.VerifyManifest(args[0], ops.ManifestOpts{
+				Path:      args[1],
+				Recursive: recursive,
+				MaxDepth:  maxDepth,
+				Quiet:     cfg.Quiet,
+				Config:    cfg,
+			})
+			if err != nil {
+				return err
+			}
+
+			if res.Changed > 0 || res.Missing > 0 || res.Unreadable > 0 || (!ignoreExtra && res.Extra > 0) {
+				os.Exit(2)
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVarP(&recursive, "recursive", "r", false, "descend into nested ZIP archives (use the same setting as create)")
+	cmd.Flags().IntVar(&maxDepth, "max-depth", 5, "maximum nesting depth for --recursive")
+	cmd.Flags().BoolVar(&ignoreExtra, "ignore-extra", false, "don't fail on files that are not in the manifest")
+
+	return cmd
+}
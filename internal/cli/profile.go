@@ -0,0 +1,46 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/c-a-ray/dkit/internal/core"
+	"github.com/c-a-ray/dkit/internal/ops"
+	"github.com/spf13/cobra"
+)
+
+func addProfileCmd(root *cobra.Command, cfg *core.Config) {
+	var top int
+	var exactDistinct int
+	var threshold float64
+	var asJSON bool
+
+	cmd := &cobra.Command{
+		Use:   "profile [files...]",
+		Short: "Profile every column: inferred type, nulls, distinct values, lengths, top values",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			list, err := core.ExpandFiles(args)
+			if err != nil {
+				return err
+			}
+			if threshold <= 0 || threshold > 1 {
+				return fmt.Errorf("--type-threshold must be in (0, 1], got %v", threshold)
+			}
+
+			return ops.Profile(list, ops.ProfileOpts{
+				Top:           top,
+				ExactDistinct: exactDistinct,
+				TypeThreshold: threshold,
+				JSON:          asJSON,
+				Config:        cfg,
+			})
+		},
+	}
+
+	cmd.Flags().IntVar(&top, "top", 5, "number of most frequent values to show per column")
+	cmd.Flags().IntVar(&exactDistinct, "exact-distinct", 100_000, "distinct values counted exactly per column before estimating with HyperLogLog (0 for no limit)")
+	cmd.Flags().Float64Var(&threshold, "type-threshold", 0.95, "share of non-empty values that must match a type for it to be inferred")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "write profiles as JSON")
+
+	root.AddCommand(cmd)
+}
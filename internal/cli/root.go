@@ -25,6 +25,11 @@ func NewRootCmd(cfg *core.Config) *cobra.Command {
 	addFilesCmd(rootCmd, cfg)
 	addFmtCmd(rootCmd, cfg)
 	addCmpCmd(rootCmd, cfg)
+	addManifestCmd(rootCmd, cfg)
+	addProfileCmd(rootCmd, cfg)
+	addValidateCmd(rootCmd, cfg)
+	addSchemaCmd(rootCmd, cfg)
+	addXtabCmd(rootCmd, cfg)
 
 	return rootCmd
 }
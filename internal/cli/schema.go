@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/c-a-ray/dkit/internal/core"
+	"github.com/c-a-ray/dkit/internal/ops"
+	"github.com/spf13/cobra"
+)
+
+func addSchemaCmd(root *cobra.Command, cfg *core.Config) {
+	schemaCmd := &cobra.Command{
+		Use:   "schema",
+		Short: "Work with schemas used by validate",
+	}
+
+	schemaCmd.AddCommand(newSchemaInferCmd(cfg))
+
+	root.AddCommand(schemaCmd)
+}
+
+func newSchemaInferCmd(cfg *core.Config) *cobra.Command {
+	var output string
+	var maxEnum int
+	var exactDistinct int
+	var threshold float64
+
+	cmd := &cobra.Command{
+		Use:   "infer [files...]",
+		Short: "Scan files and write a starting schema for validate",
+		Long: `Scan files and write a YAML schema describing the data: inferred types,
+nullability, allowed values for low-cardinality columns, and maximum lengths.
+Columns missing from some files are marked required: false. The result is
+meant to be reviewed and edited, then passed to 'dkit validate --schema'.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			list, err := core.ExpandFiles(args)
+			if err != nil {
+				return err
+			}
+			if threshold <= 0 || threshold > 1 {
+				return fmt.Errorf("--type-threshold must be in (0, 1], got %v", threshold)
+			}
+
+			schema, err := ops.InferSchema(list, ops.SchemaInferOpts{
+				MaxEnum:       maxEnum,
+				ExactDistinct: exactDistinct,
+				TypeThreshold: threshold,
+				Config:        cfg,
+			})
+			if err != nil {
+				return err
+			}
+			if err := ops.WriteSchema(output, schema); err != nil {
+				return err
+			}
+			if output != "" && !cfg.Quiet {
+				fmt.Fprintf(os.Stderr, "Wrote schema with %d columns to %s\n", len(schema.Columns), output)
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "", "write the schema to a file instead of stdout")
+	cmd.Flags().IntVar(&maxEnum, "max-enum", 10, "record allowed values for columns with at most this many distinct values (0 to disable)")
+	cmd.Flags().IntVar(&exactDistinct, "exact-distinct", 100_000, "distinct values counted exactly per column before estimating (0 for no limit)")
+	cmd.Flags().Float64Var(&threshold, "type-threshold", 1, "share of non-empty values that must match a type for it to be inferred")
+
+	return cmd
+}
@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"os"
+
+	"github.com/c-a-ray/dkit/internal/core"
+	"github.com/c-a-ray/dkit/internal/ops"
+	"github.com/spf13/cobra"
+)
+
+func addValidateCmd(root *cobra.Command, cfg *core.Config) {
+	var schemaPath string
+	var asJSON bool
+	var maxErrors int
+
+	cmd := &cobra.Command{
+		Use:   "validate --schema <schema.yaml> [files...]",
+		Short: "Check files against a YAML schema of columns, types, patterns, and constraints",
+		Long: `Check files against a YAML schema. Example schema:
+
+  ordered: true          # declared columns must appear in this order
+  allow_extra: false     # fail on columns the schema does not declare
+  columns:
+    - name: id
+      type: integer      # boolean, date, datetime, integer, decimal, zip, phone, email, text
+      nullable: false    # default true
+      unique: true
+    - name: state
+      allowed: [CA, NY, TX]
+    - name: code
+      pattern: '[A-Z]{3}-[0-9]+'   # must match the whole value
+      required: false    # default true; the column may be absent
+
+Exits with code 2 if any violations are found.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			schema, err := ops.LoadSchema(schemaPath)
+			if err != nil {
+				return err
+			}
+			list, err := core.ExpandFiles(args)
+			if err != nil {
+				return err
+			}
+
+			res, err := ops.Validate(list, ops.ValidateOpts{
+				Schema:    schema,
+				JSON:      asJSON,
+				MaxErrors: maxErrors,
+				Quiet:     cfg.Quiet,
+				Config:    cfg,
+			})
+			if err != nil {
+				return err
+			}
+			if res.Violations > 0 {
+				os.Exit(2)
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&schemaPath, "schema", "", "path to the YAML schema")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "write violations as JSON")
+	cmd.Flags().IntVar(&maxErrors, "max-errors", 50, "maximum violations reported per file (0 for no limit)")
+	_ = cmd.MarkFlagRequired("schema")
+
+	root.AddCommand(cmd)
+}
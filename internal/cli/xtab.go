@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/c-a-ray/dkit/internal/core"
+	"github.com/c-a-ray/dkit/internal/ops"
+	"github.com/spf13/cobra"
+)
+
+func addXtabCmd(root *cobra.Command, cfg *core.Config) {
+	var nullTok string
+	var whenFlags []string
+
+	cmd := &cobra.Command{
+		Use:   "xtab <ROWCOL> <COLCOL> [files...]",
+		Short: "Cross-tabulate two columns into a contingency table with totals",
+		Args:  cobra.MinimumNArgs(3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			list, err := core.ExpandFiles(args[2:])
+			if err != nil {
+				return err
+			}
+
+			filter, err := ops.ParseWhenFlags(whenFlags)
+			if err != nil {
+				return fmt.Errorf("invalid --when: %w", err)
+			}
+
+			return ops.CrossTab(list, ops.XtabOpts{
+				RowColumn: args[0],
+				ColColumn: args[1],
+				NullToken: nullTok,
+				Filter:    filter,
+				Config:    cfg,
+			})
+		},
+	}
+
+	cmd.Flags().StringVar(&nullTok, "null-token", "<EMPTY>", "label for empty cells")
+	cmd.Flags().StringArrayVarP(&whenFlags, "when", "w", nil, whenUsage)
+
+	root.AddCommand(cmd)
+}
@@ -18,21 +18,30 @@ func OpenWithEncoding(path string, enc string) (io.ReadCloser, error) {
 		return nil, err
 	}
 
+	r := DecodeReader(f, enc)
+	if r == io.Reader(f) {
+		return f, nil
+	}
+	rc := struct {
+		io.Reader
+		io.Closer
+	}{
+		Reader: r,
+		Closer: f,
+	}
+	return rc, nil
+}
+
+// DecodeReader wraps r with a decoder if the specified encoding requires one
+func DecodeReader(r io.Reader, enc string) io.Reader {
 	switch strings.ToLower(enc) {
 	case "", "utf-8", "utf8", "utf-8-sig":
-		return f, nil
+		return r
 	case "latin1", "iso-8859-1":
-		rc := struct {
-			io.Reader
-			io.Closer
-		}{
-			Reader: transform.NewReader(bufio.NewReader(f), charmap.ISO8859_1.NewDecoder()),
-			Closer: f,
-		}
-		return rc, nil
+		return transform.NewReader(bufio.NewReader(r), charmap.ISO8859_1.NewDecoder())
 	default:
 		// Fallback: return raw and let ops decide; can add more encodings later
-		return f, nil
+		return r
 	}
 }
 
@@ -0,0 +1,12 @@
+package core
+
+import "os"
+
+// IsTerminal reports whether f refers to a character device such as a terminal
+func IsTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
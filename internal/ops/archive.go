@@ -0,0 +1,449 @@
+package ops
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// archiveMember is a regular file inside a ZIP, tar archive, or directory
+// crc and digest are filled in when the source provides them cheaply
+type archiveMember struct {
+	name   string
+	size   uint64
+	crc    uint32
+	hasCRC bool
+	digest []byte
+	path   string // set when the member is a file on disk
+	binary bool   // known to be binary without reading it again
+	meta   memberMeta
+	open   func() (io.ReadCloser, error)
+}
+
+// archive is a set of members keyed by slash-separated relative path
+// Members of expanded nested ZIPs are keyed "outer.zip!/inner/path"
+type archive struct {
+	kind       string
+	members    map[string]*archiveMember
+	comment    string
+	hasComment bool
+	cleanup    []func() error
+}
+
+// Close releases readers and temporary files in reverse order of acquisition
+func (a *archive) Close() error {
+	var first error
+	for i := len(a.cleanup) - 1; i >= 0; i-- {
+		if err := a.cleanup[i](); err != nil && first == nil {
+			first = err
+		}
+	}
+	a.cleanup = nil
+	return first
+}
+
+// openArchive opens a ZIP, tar (optionally gzipped) archive, or directory,
+// detecting which from the path itself
+func openArchive(p string, again readAgain) (*archive, error) {
+	fi, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return openDirArchive(p)
+	}
+
+	kind, err := sniffArchiveKind(p)
+	if err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case "zip":
+		return openZipArchive(p)
+	case "tar", "tar.gz":
+		return openTarArchive(p, kind == "tar.gz", again)
+	default:
+		// A ZIP with data prepended, such as a self-extracting archive, is
+		// found from the central directory at the end instead
+		if a, err := openZipArchive(p); err == nil {
+			return a, nil
+		}
+		return nil, fmt.Errorf("unrecognized archive format (expected ZIP, tar, tar.gz, or a directory)")
+	}
+}
+
+// readAgain says which members will be read after an archive is indexed;
+// for tar archives these are kept from the indexing pass rather than found
+// again by rescanning
+type readAgain struct {
+	text   bool // text members up to maxDiffBytes, for diffs and row counts
+	nested bool // .zip members, for nested expansion
+}
+
+func sniffArchiveKind(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	head = head[:n]
+
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return "zip", nil
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return "tar.gz", nil
+	case len(head) >= 262 && string(head[257:262]) == "ustar":
+		return "tar", nil
+	}
+	return "", nil
+}
+
+func openZipArchive(p string) (*archive, error) {
+	r, err := zip.OpenReader(p)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &archive{
+		kind:       "ZIP archive",
+		members:    map[string]*archiveMember{},
+		comment:    r.Comment,
+		hasComment: true,
+		cleanup:    []func() error{r.Close},
+	}
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		a.members[f.Name] = &archiveMember{
+			name:   f.Name,
+			size:   f.UncompressedSize64,
+			crc:    f.CRC32,
+			hasCRC: true,
+			meta: memberMeta{
+				modified: f.Modified,
+				// Without an extended timestamp the reader reports the MS-DOS
+				// wall-clock time in UTC
+				wallClock: f.Modified.Location() == time.UTC,
+				mode:      f.Mode(),
+				// Only Unix hosts record permission bits
+				hasMode:    f.CreatorVersion>>8 == zipCreatorUnix,
+				method:     zipMethodName(f.Method),
+				comment:    f.Comment,
+				hasZipMeta: true,
+			},
+			open: f.Open,
+		}
+	}
+	return a, nil
+}
+
+func openDirArchive(root string) (*archive, error) {
+	a := &archive{kind: "directory", members: map[string]*archiveMember{}}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		a.members[name] = &archiveMember{
+			name: name,
+			size: uint64(info.Size()),
+			path: p,
+			meta: memberMeta{modified: info.ModTime(), mode: info.Mode(), hasMode: true},
+			open: func() (io.ReadCloser, error) { return os.Open(p) },
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// openTarArchive indexes a tar archive in a single streaming pass, hashing
+// each member as it goes since tar streams cannot be read out of order
+// Members again says will be read, text up to maxDiffBytes and nested ZIPs,
+// are copied to one temporary file during the pass; any other member is only
+// hashed and is streamed by rescanning the archive if it is ever opened. A
+// name repeated in the archive refers to its last entry, as when extracting
+func openTarArchive(p string, gzipped bool, again readAgain) (*archive, error) {
+	a := &archive{kind: "tar archive", members: map[string]*archiveMember{}}
+
+	var spill *os.File
+	var spillSize int64
+	seen := map[string]int{}
+
+	err := walkTar(p, gzipped, func(hdr *tar.Header, r io.Reader) (bool, error) {
+		name := cleanTarName(hdr.Name)
+		occurrence := seen[name]
+		seen[name]++
+
+		head := make([]byte, 512)
+		n, err := io.ReadFull(r, head)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return false, fmt.Errorf("%s: %w", hdr.Name, err)
+		}
+		head = head[:n]
+		text := isLikelyText(head)
+		keep := (again.text && text && hdr.Size <= maxDiffBytes) ||
+			(again.nested && strings.HasSuffix(strings.ToLower(name), ".zip"))
+
+		crc := crc32.NewIEEE()
+		sum := sha256.New()
+		w := io.MultiWriter(crc, sum)
+		offset := spillSize
+		if keep {
+			if spill == nil {
+				spill, err = os.CreateTemp("", "dkit-tar-*")
+				if err != nil {
+					return false, err
+				}
+				tmp := spill
+				a.cleanup = append(a.cleanup, func() error {
+					tmp.Close()
+					return os.Remove(tmp.Name())
+				})
+			}
+			w = io.MultiWriter(crc, sum, spill)
+		}
+		if _, err := w.Write(head); err != nil {
+			return false, fmt.Errorf("%s: %w", hdr.Name, err)
+		}
+		rest, err := io.Copy(w, r)
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", hdr.Name, err)
+		}
+
+		m := &archiveMember{
+			name:   name,
+			size:   uint64(hdr.Size),
+			crc:    crc.Sum32(),
+			hasCRC: true,
+			digest: sum.Sum(nil),
+			binary: !text,
+			meta:   memberMeta{modified: hdr.ModTime, mode: hdr.FileInfo().Mode(), hasMode: true},
+		}
+		if keep {
+			length := int64(len(head)) + rest
+			spillSize += length
+			content := spill
+			m.open = func() (io.ReadCloser, error) {
+				return io.NopCloser(io.NewSectionReader(content, offset, length)), nil
+			}
+		} else {
+			m.open = func() (io.ReadCloser, error) {
+				return openTarMember(p, gzipped, name, occurrence)
+			}
+		}
+		a.members[name] = m
+		return true, nil
+	})
+	if err != nil {
+		a.Close()
+		return nil, err
+	}
+	return a, nil
+}
+
+// walkTar calls fn for every regular file in a tar archive until fn returns
+// false or an error
+func walkTar(p string, gzipped bool, fn func(hdr *tar.Header, r io.Reader) (bool, error)) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = bufio.NewReader(f)
+	if gzipped {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		more, err := fn(hdr, tr)
+		if err != nil || !more {
+			return err
+		}
+	}
+}
+
+// openTarMember rescans the archive and streams the given occurrence of a
+// member through a pipe; it is only used for members not kept while indexing
+func openTarMember(p string, gzipped bool, name string, occurrence int) (io.ReadCloser, error) {
+	pr, pw := io.Pipe()
+	go func() {
+		found := false
+		n := 0
+		err := walkTar(p, gzipped, func(hdr *tar.Header, r io.Reader) (bool, error) {
+			if cleanTarName(hdr.Name) != name {
+				return true, nil
+			}
+			if n < occurrence {
+				n++
+				return true, nil
+			}
+			found = true
+			_, err := io.Copy(pw, r)
+			return false, err
+		})
+		if err == nil && !found {
+			err = fmt.Errorf("%s not found in %s", name, p)
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr, nil
+}
+
+func cleanTarName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// sha256 returns the member's SHA-256, streaming the content if the source
+// did not already record it
+func (m *archiveMember) sha256() ([]byte, error) {
+	if m.digest != nil {
+		return m.digest, nil
+	}
+	rc, err := m.open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, rc); err != nil {
+		return nil, err
+	}
+	m.digest = h.Sum(nil)
+	return m.digest, nil
+}
+
+// read reads at most limit bytes of the member
+func (m *archiveMember) read(limit int64) ([]byte, error) {
+	rc, err := m.open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return io.ReadAll(io.LimitReader(rc, limit))
+}
+
+// nestedSep joins an outer archive member to a path inside it
+const nestedSep = "!/"
+
+// expandNestedZips replaces members that are themselves ZIP archives with
+// their contents, descending at most depth levels; nested archives that
+// cannot be opened are left in place and compared as opaque files
+func (a *archive) expandNestedZips(depth int) {
+	failed := map[string]bool{}
+	for range depth {
+		var nested []string
+		for name := range a.members {
+			if !failed[name] && strings.HasSuffix(strings.ToLower(name), ".zip") {
+				nested = append(nested, name)
+			}
+		}
+		if len(nested) == 0 {
+			return
+		}
+		sort.Strings(nested)
+
+		for _, name := range nested {
+			inner, err := a.openNested(a.members[name])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "[WARN] cannot open nested archive %s: %v\n", name, err)
+				failed[name] = true
+				continue
+			}
+			delete(a.members, name)
+			for n, m := range inner.members {
+				m.name = name + nestedSep + n
+				a.members[m.name] = m
+			}
+		}
+	}
+}
+
+// openNested opens a member as a ZIP archive, spilling it to a temporary
+// file first unless it already lives on disk; cleanup is tied to a
+func (a *archive) openNested(m *archiveMember) (*archive, error) {
+	p := m.path
+	if p == "" {
+		tmp, err := os.CreateTemp("", "dkit-nested-*.zip")
+		if err != nil {
+			return nil, err
+		}
+		a.cleanup = append(a.cleanup, func() error { return os.Remove(tmp.Name()) })
+
+		rc, err := m.open()
+		if err != nil {
+			tmp.Close()
+			return nil, err
+		}
+		_, err = io.Copy(tmp, rc)
+		rc.Close()
+		if cerr := tmp.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return nil, err
+		}
+		p = tmp.Name()
+	}
+
+	inner, err := openZipArchive(p)
+	if err != nil {
+		return nil, err
+	}
+	a.cleanup = append(a.cleanup, inner.Close)
+	return inner, nil
+}
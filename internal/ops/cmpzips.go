@@ -1,67 +1,95 @@
 package ops
 
 import (
-	"archive/zip"
+	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"sort"
-	"strings"
 
 	"github.com/c-a-ray/dkit/internal/core"
 )
 
-// ZipCmpOpts configures how two ZIP archives are compared
-type ZipCmpOpts struct {
-	ZipA          string
-	ZipB          string
+// ArchiveCmpOpts configures how two archives are compared
+// PathA and PathB may each be a ZIP archive, a tar archive (optionally
+// gzipped), or a directory, so mixed comparisons work the same way
+// Recursive descends into nested ZIP members up to MaxDepth levels
+// Paths filters members and controls how names are paired across archives
+type ArchiveCmpOpts struct {
+	PathA         string
+	PathB         string
 	Quiet         bool
 	SummaryOnly   bool
 	IgnoreMissing bool
-	Config        *core.Config
+	TrustCRC      bool
+	Recursive     bool
+	MaxDepth      int
+	Paths         PathMapOpts
+	// FindRenames pairs members only in A with members only in B by content
+	// hash, then text members by line similarity of at least RenameThreshold
+	FindRenames     bool
+	RenameThreshold float64
+	// Metadata also reports modification time, permission, compression
+	// method, and comment differences, plus archive comment differences
+	Metadata bool
+	Diff     DiffOpts
+	Config   *core.Config
 }
 
-// ZipCmpResult summarizes the outcome of a ZIP comparison
-type ZipCmpResult struct {
+// ArchiveCmpResult summarizes the outcome of an archive comparison
+type ArchiveCmpResult struct {
 	Identical int
 	Different int
 	OnlyInA   int
 	OnlyInB   int
+	// Renamed counts members paired across different names with identical
+	// content; RenamedModified counts pairs matched by text similarity
+	Renamed         int
+	RenamedModified int
+	// MetadataDiffs counts common members whose metadata differs, plus one
+	// for a differing archive comment; only set with ArchiveCmpOpts.Metadata
+	MetadataDiffs int
 }
 
-// CompareZips compares two ZIP archives and reports differences
-func CompareZips(opts ZipCmpOpts) (ZipCmpResult, error) {
-	result := ZipCmpResult{}
+// CompareArchives compares two archives or directories and reports differences
+func CompareArchives(opts ArchiveCmpOpts) (ArchiveCmpResult, error) {
+	result := ArchiveCmpResult{}
 
-	readerA, err := zip.OpenReader(opts.ZipA)
+	mapper, err := opts.Paths.compile()
 	if err != nil {
-		return result, fmt.Errorf("failed to open %s: %w", opts.ZipA, err)
+		return result, err
 	}
-	defer readerA.Close()
 
-	readerB, err := zip.OpenReader(opts.ZipB)
+	// Member content is read again for previews, normalized comparisons,
+	// rename similarity, and nested expansion
+	again := readAgain{
+		text: (!opts.SummaryOnly && !opts.Quiet) || opts.Diff.IgnoreSpace || opts.Diff.IgnoreEOL ||
+			opts.FindRenames,
+		nested: opts.Recursive,
+	}
+	archA, err := openArchive(opts.PathA, again)
 	if err != nil {
-		return result, fmt.Errorf("failed to open %s: %w", opts.ZipB, err)
+		return result, fmt.Errorf("failed to open %s: %w", opts.PathA, err)
 	}
-	defer readerB.Close()
-
-	filesA := make(map[string]*zip.File)
-	filesB := make(map[string]*zip.File)
+	defer archA.Close()
 
-	for _, f := range readerA.File {
-		if !f.FileInfo().IsDir() {
-			filesA[f.Name] = f
-		}
+	archB, err := openArchive(opts.PathB, again)
+	if err != nil {
+		return result, fmt.Errorf("failed to open %s: %w", opts.PathB, err)
 	}
+	defer archB.Close()
 
-	for _, f := range readerB.File {
-		if !f.FileInfo().IsDir() {
-			filesB[f.Name] = f
-		}
+	if opts.Recursive {
+		archA.expandNestedZips(opts.MaxDepth)
+		archB.expandNestedZips(opts.MaxDepth)
 	}
 
+	filesA := mapper.apply(archA.members, "A")
+	filesB := mapper.apply(archB.members, "B")
+
 	allFiles := make(map[string]bool)
 	for name := range filesA {
 		allFiles[name] = true
@@ -79,13 +107,13 @@ func CompareZips(opts ZipCmpOpts) (ZipCmpResult, error) {
 	if !opts.Quiet {
 		fmt.Fprintf(os.Stderr, "\n")
 		fmt.Fprintf(os.Stderr, "═══════════════════════════════════════════════════════════\n")
-		fmt.Fprintf(os.Stderr, "Comparing ZIP archives\n")
+		fmt.Fprintf(os.Stderr, "%s\n", cmpTitle(archA.kind, archB.kind))
 		fmt.Fprintf(os.Stderr, "═══════════════════════════════════════════════════════════\n")
-		fmt.Fprintf(os.Stderr, "\nArchive A: %s\n", filepath.Base(opts.ZipA))
-		fmt.Fprintf(os.Stderr, "Archive B: %s\n\n", filepath.Base(opts.ZipB))
+		fmt.Fprintf(os.Stderr, "\nArchive A: %s\n", filepath.Base(opts.PathA))
+		fmt.Fprintf(os.Stderr, "Archive B: %s\n\n", filepath.Base(opts.PathB))
 	}
 
-	var commonFiles []string
+	var commonFiles, onlyA, onlyB []string
 	for _, name := range sortedFiles {
 		inA := filesA[name] != nil
 		inB := filesB[name] != nil
@@ -93,14 +121,60 @@ func CompareZips(opts ZipCmpOpts) (ZipCmpResult, error) {
 		if inA && inB {
 			commonFiles = append(commonFiles, name)
 		} else if inA && !inB {
-			result.OnlyInA++
+			onlyA = append(onlyA, name)
+		} else if !inA && inB {
+			onlyB = append(onlyB, name)
+		}
+	}
+
+	var renames []renamePair
+	if opts.FindRenames && len(onlyA) > 0 && len(onlyB) > 0 {
+		renames, onlyA, onlyB = findRenames(filesA, filesB, onlyA, onlyB, opts.RenameThreshold, opts.Diff)
+	}
+
+	for _, name := range onlyA {
+		result.OnlyInA++
+		if !opts.Quiet {
+			fmt.Printf("→ %s (only in A)\n", filesA[name].name)
+		}
+	}
+	for _, name := range onlyB {
+		result.OnlyInB++
+		if !opts.Quiet {
+			fmt.Printf("→ %s (only in B)\n", filesB[name].name)
+		}
+	}
+
+	if len(renames) > 0 && !opts.Quiet {
+		fmt.Fprintf(os.Stderr, "\nRenamed or moved files:\n\n")
+	}
+
+	for _, p := range renames {
+		memA, memB := filesA[p.keyA], filesB[p.keyB]
+		name := memA.name + " → " + memB.name
+
+		if p.exact {
+			result.Renamed++
 			if !opts.Quiet {
-				fmt.Printf("→ %s (only in A)\n", name)
+				fmt.Printf("↪ %s (%s, identical)\n", name, p.kind(memA, memB))
 			}
-		} else if !inA && inB {
-			result.OnlyInB++
+			continue
+		}
+
+		identical, err := compareMembers(memA, memB, name, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[WARN] error comparing %s: %v\n", name, err)
+			continue
+		}
+		if identical {
+			result.Renamed++
+			if !opts.Quiet {
+				fmt.Printf("↪ %s (%s, identical)\n", name, p.kind(memA, memB))
+			}
+		} else {
+			result.RenamedModified++
 			if !opts.Quiet {
-				fmt.Printf("→ %s (only in B)\n", name)
+				fmt.Printf("↪ %s (%s, %.0f%% similar)\n", name, p.kind(memA, memB), p.similarity*100)
 			}
 		}
 	}
@@ -109,8 +183,9 @@ func CompareZips(opts ZipCmpOpts) (ZipCmpResult, error) {
 		fmt.Fprintf(os.Stderr, "\nComparing common files:\n\n")
 	}
 
-	for _, name := range commonFiles {
-		identical, err := compareZipFiles(filesA[name], filesB[name], name, opts)
+	for _, key := range commonFiles {
+		name := pairName(filesA[key], filesB[key])
+		identical, err := compareMembers(filesA[key], filesB[key], name, opts)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "[WARN] error comparing %s: %v\n", name, err)
 			continue
@@ -127,6 +202,24 @@ func CompareZips(opts ZipCmpOpts) (ZipCmpResult, error) {
 				fmt.Printf("⚠ %s (different)\n", name)
 			}
 		}
+
+		if opts.Metadata {
+			if diffs := metaDiffs(filesA[key].meta, filesB[key].meta); len(diffs) > 0 {
+				result.MetadataDiffs++
+				if !opts.Quiet {
+					for _, d := range diffs {
+						fmt.Printf("    ↳ %s\n", d)
+					}
+				}
+			}
+		}
+	}
+
+	if opts.Metadata && archA.hasComment && archB.hasComment && archA.comment != archB.comment {
+		result.MetadataDiffs++
+		if !opts.Quiet {
+			fmt.Printf("\n⚠ archive comment differs: A=%q, B=%q\n", archA.comment, archB.comment)
+		}
 	}
 
 	// Print summary
@@ -139,86 +232,265 @@ func CompareZips(opts ZipCmpOpts) (ZipCmpResult, error) {
 	fmt.Fprintf(os.Stderr, "Different files:  %d\n", result.Different)
 	fmt.Fprintf(os.Stderr, "Only in A:        %d\n", result.OnlyInA)
 	fmt.Fprintf(os.Stderr, "Only in B:        %d\n", result.OnlyInB)
+	if opts.FindRenames {
+		fmt.Fprintf(os.Stderr, "Renamed:          %d\n", result.Renamed)
+		fmt.Fprintf(os.Stderr, "Renamed+modified: %d\n", result.RenamedModified)
+	}
+	if opts.Metadata {
+		fmt.Fprintf(os.Stderr, "Metadata diffs:   %d\n", result.MetadataDiffs)
+	}
 	fmt.Fprintf(os.Stderr, "\n")
 
 	return result, nil
 }
 
-func compareZipFiles(fileA, fileB *zip.File, name string, opts ZipCmpOpts) (bool, error) {
-	rcA, err := fileA.Open()
-	if err != nil {
-		return false, fmt.Errorf("failed to open %s from archive A: %w", name, err)
+// pairName labels a pair of members, showing both names when path mapping
+// paired members whose names differ
+func pairName(memA, memB *archiveMember) string {
+	if memA.name == memB.name {
+		return memA.name
 	}
-	defer rcA.Close()
+	return memA.name + " ⇄ " + memB.name
+}
 
-	var bufA bytes.Buffer
-	if _, err := io.Copy(&bufA, rcA); err != nil {
-		return false, fmt.Errorf("failed to read %s from archive A: %w", name, err)
+// cmpTitle names the kind of comparison, e.g. "Comparing ZIP archives" or
+// "Comparing ZIP archive against directory"
+func cmpTitle(kindA, kindB string) string {
+	if kindA == kindB {
+		if kindA == "directory" {
+			return "Comparing directories"
+		}
+		return "Comparing " + kindA + "s"
 	}
+	return "Comparing " + kindA + " against " + kindB
+}
 
-	rcB, err := fileB.Open()
+// maxDiffBytes caps the size of members loaded into memory for a line diff
+const maxDiffBytes = 64 << 20
+
+// compareMembers decides whether two members are identical without loading
+// them into memory; content is only materialized when a diff preview or
+// whitespace-insensitive comparison needs it
+func compareMembers(memA, memB *archiveMember, name string, opts ArchiveCmpOpts) (bool, error) {
+	same, err := sameContent(memA, memB, name, opts.TrustCRC)
 	if err != nil {
-		return false, fmt.Errorf("failed to open %s from archive B: %w", name, err)
+		return false, err
+	}
+	if same {
+		return true, nil
 	}
-	defer rcB.Close()
 
-	var bufB bytes.Buffer
-	if _, err := io.Copy(&bufB, rcB); err != nil {
+	normalize := opts.Diff.IgnoreSpace || opts.Diff.IgnoreEOL
+	preview := !opts.SummaryOnly && !opts.Quiet
+	if !normalize && !preview {
+		return false, nil
+	}
+
+	if memA.binary || memB.binary {
+		if preview {
+			showSizePreview(name, memA.size, memB.size, "")
+		}
+		return false, nil
+	}
+
+	// Read each member once: whole when it can be diffed, otherwise just
+	// enough to tell text from binary
+	fits := memA.size <= maxDiffBytes && memB.size <= maxDiffBytes
+	limit := int64(512)
+	if fits {
+		limit = maxDiffBytes
+	}
+	contentA, err := memA.read(limit)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s from archive A: %w", name, err)
+	}
+	contentB, err := memB.read(limit)
+	if err != nil {
 		return false, fmt.Errorf("failed to read %s from archive B: %w", name, err)
 	}
 
-	identical := bytes.Equal(bufA.Bytes(), bufB.Bytes())
+	if !isLikelyText(contentA) || !isLikelyText(contentB) {
+		if preview {
+			showSizePreview(name, memA.size, memB.size, "")
+		}
+		return false, nil
+	}
+	if !fits {
+		// Too large to diff, but ignored differences can still be ruled out
+		// by streaming both sides line by line
+		if normalize {
+			same, err := normalizedEqual(memA, memB, opts.Diff)
+			if err != nil {
+				return false, fmt.Errorf("failed to read %s: %w", name, err)
+			}
+			if same {
+				return true, nil
+			}
+		}
+		if preview {
+			showSizePreview(name, memA.size, memB.size, "too large for a line diff")
+		}
+		return false, nil
+	}
+
+	hunks := lineDiff(splitLines(contentA), splitLines(contentB), opts.Diff)
+	// With whitespace or line-ending insensitivity, no hunks means the
+	// members only differ in ways the caller asked to ignore
+	if len(hunks) == 0 && normalize {
+		return true, nil
+	}
 
-	if !identical && !opts.SummaryOnly && !opts.Quiet {
-		showDiffPreview(name, bufA.Bytes(), bufB.Bytes())
+	if preview {
+		showDiffPreview(name, memA.name, memB.name, hunks, opts.Diff)
 	}
 
-	return identical, nil
+	return false, nil
 }
 
-func showDiffPreview(name string, contentA, contentB []byte) {
-	fmt.Fprintf(os.Stderr, "\n  Differences in %s:\n", name)
+// sameContent compares two members using recorded sizes and CRC-32s where
+// available, then digests (when either side already has one) or a streaming
+// byte comparison; trustCRC accepts matching CRC-32s without reading content
+func sameContent(memA, memB *archiveMember, name string, trustCRC bool) (bool, error) {
+	if memA.size != memB.size {
+		return false, nil
+	}
+	if memA.hasCRC && memB.hasCRC {
+		if memA.crc != memB.crc {
+			return false, nil
+		}
+		if trustCRC {
+			return true, nil
+		}
+	}
 
-	if isLikelyText(contentA) && isLikelyText(contentB) {
-		linesA := strings.Split(string(contentA), "\n")
-		linesB := strings.Split(string(contentB), "\n")
+	if memA.digest != nil || memB.digest != nil {
+		sumA, err := memA.sha256()
+		if err != nil {
+			return false, fmt.Errorf("failed to read %s from archive A: %w", name, err)
+		}
+		sumB, err := memB.sha256()
+		if err != nil {
+			return false, fmt.Errorf("failed to read %s from archive B: %w", name, err)
+		}
+		return bytes.Equal(sumA, sumB), nil
+	}
 
-		maxLines := 10
-		lineCount := 0
+	rcA, err := memA.open()
+	if err != nil {
+		return false, fmt.Errorf("failed to open %s from archive A: %w", name, err)
+	}
+	defer rcA.Close()
 
-		for i := 0; i < len(linesA) || i < len(linesB); i++ {
-			if lineCount >= maxLines {
-				fmt.Fprintf(os.Stderr, "  ... (diff truncated)\n")
-				break
-			}
+	rcB, err := memB.open()
+	if err != nil {
+		return false, fmt.Errorf("failed to open %s from archive B: %w", name, err)
+	}
+	defer rcB.Close()
 
-			var lineA, lineB string
-			if i < len(linesA) {
-				lineA = linesA[i]
-			}
-			if i < len(linesB) {
-				lineB = linesB[i]
-			}
+	same, err := streamEqual(rcA, rcB)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return same, nil
+}
 
-			if lineA != lineB {
-				fmt.Fprintf(os.Stderr, "  Line %d:\n", i+1)
-				if lineA != "" {
-					fmt.Fprintf(os.Stderr, "    A: %s\n", truncateLine(lineA, 80))
-				}
-				if lineB != "" {
-					fmt.Fprintf(os.Stderr, "    B: %s\n", truncateLine(lineB, 80))
+// normalizedEqual compares two members line by line after normalizeDiffLine
+// without holding either in memory; a line too long to buffer counts as a
+// difference
+func normalizedEqual(memA, memB *archiveMember, o DiffOpts) (bool, error) {
+	rcA, err := memA.open()
+	if err != nil {
+		return false, err
+	}
+	defer rcA.Close()
+	rcB, err := memB.open()
+	if err != nil {
+		return false, err
+	}
+	defer rcB.Close()
+
+	sa, sb := newLineScanner(rcA), newLineScanner(rcB)
+	for {
+		okA, okB := sa.Scan(), sb.Scan()
+		if !okA || !okB {
+			for _, err := range []error{sa.Err(), sb.Err()} {
+				if errors.Is(err, bufio.ErrTooLong) {
+					return false, nil
+				} else if err != nil {
+					return false, err
 				}
-				lineCount++
 			}
+			return okA == okB, nil
+		}
+		if normalizeDiffLine(sa.Text(), o) != normalizeDiffLine(sb.Text(), o) {
+			return false, nil
+		}
+	}
+}
+
+// newLineScanner splits lines like splitLines, keeping any trailing \r so
+// normalizeDiffLine decides whether it matters
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64<<10), maxDiffBytes)
+	s.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			return i + 1, data[:i], nil
 		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	})
+	return s
+}
+
+// streamEqual compares two readers chunk by chunk
+func streamEqual(a, b io.Reader) (bool, error) {
+	bufA := make([]byte, 64<<10)
+	bufB := make([]byte, 64<<10)
+	for {
+		nA, errA := io.ReadFull(a, bufA)
+		if errA != nil && errA != io.EOF && errA != io.ErrUnexpectedEOF {
+			return false, errA
+		}
+		nB, errB := io.ReadFull(b, bufB)
+		if errB != nil && errB != io.EOF && errB != io.ErrUnexpectedEOF {
+			return false, errB
+		}
+		if nA != nB || !bytes.Equal(bufA[:nA], bufB[:nB]) {
+			return false, nil
+		}
+		// Equal short reads mean both readers hit EOF together
+		if errA != nil {
+			return true, nil
+		}
+	}
+}
+
+func showDiffPreview(name, nameA, nameB string, hunks []diffHunk, o DiffOpts) {
+	fmt.Fprintf(os.Stderr, "\n  Differences in %s:\n", name)
+
+	if len(hunks) == 0 {
+		fmt.Fprintf(os.Stderr, "  (no line differences; contents differ only in the trailing newline)\n")
 	} else {
-		// For binary files just show file size difference
-		fmt.Fprintf(os.Stderr, "  File sizes: A=%d bytes, B=%d bytes\n", len(contentA), len(contentB))
+		writeUnified(os.Stderr, nameA, nameB, hunks, o)
 	}
 
 	fmt.Fprintf(os.Stderr, "\n")
 }
 
+// showSizePreview reports only the member sizes, used for binary members and
+// for text too large to diff
+func showSizePreview(name string, sizeA, sizeB uint64, note string) {
+	fmt.Fprintf(os.Stderr, "\n  Differences in %s:\n", name)
+	if note != "" {
+		fmt.Fprintf(os.Stderr, "  (%s)\n", note)
+	}
+	fmt.Fprintf(os.Stderr, "  File sizes: A=%d bytes, B=%d bytes\n", sizeA, sizeB)
+	fmt.Fprintf(os.Stderr, "\n")
+}
+
 func isLikelyText(content []byte) bool {
 	if len(content) == 0 {
 		return true
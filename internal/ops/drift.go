@@ -0,0 +1,266 @@
+package ops
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/c-a-ray/dkit/internal/core"
+)
+
+// DriftOpts configures the header drift report
+// SortBy orders files as "name", "mtime", or "args" (command-line order)
+type DriftOpts struct {
+	SortBy string
+	Config *core.Config
+}
+
+// fileHeader is one file's header row
+type fileHeader struct {
+	path    string
+	header  []string
+	modTime time.Time
+}
+
+// readHeader returns the first row of path
+func readHeader(path string, cfg *core.Config) ([]string, error) {
+	rc, err := core.OpenWithEncoding(path, cfg.Encoding)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	cr := core.NewCSVReader(rc, cfg.Delim, cfg.LazyQuotes)
+
+	hdr, err := cr.Read()
+	if err == io.EOF {
+		return nil, errors.New("file is empty")
+	} else if err != nil {
+		return nil, err
+	}
+	return slices.Clone(hdr), nil
+}
+
+// readHeaders reads the header of every file, warning about and skipping
+// files that cannot be read
+func readHeaders(files []string, cfg *core.Config) []fileHeader {
+	out := make([]fileHeader, 0, len(files))
+	for _, path := range files {
+		hdr, err := readHeader(path, cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[WARN] %s: %v\n", path, err)
+			continue
+		}
+		fh := fileHeader{path: path, header: hdr}
+		if fi, err := os.Stat(path); err == nil {
+			fh.modTime = fi.ModTime()
+		}
+		out = append(out, fh)
+	}
+	return out
+}
+
+// ColumnDrift reports how headers vary across files: a presence matrix,
+// groups of files sharing a header signature, and the columns added,
+// removed, or reordered from one file to the next
+func ColumnDrift(files []string, o DriftOpts) error {
+	if len(files) == 0 {
+		return errors.New("no files")
+	}
+	if o.Config.NoHeader {
+		return errors.New("col drift compares headers and cannot be used with --no-header")
+	}
+
+	headers := readHeaders(files, o.Config)
+	if len(headers) == 0 {
+		return nil
+	}
+
+	switch o.SortBy {
+	case "name":
+		sort.SliceStable(headers, func(i, j int) bool { return headers[i].path < headers[j].path })
+	case "mtime":
+		sort.SliceStable(headers, func(i, j int) bool { return headers[i].modTime.Before(headers[j].modTime) })
+	case "args":
+	default:
+		return fmt.Errorf("invalid sort %q (expected name, mtime, or args)", o.SortBy)
+	}
+
+	fmt.Printf("Files (by %s):\n", o.SortBy)
+	for i, fh := range headers {
+		fmt.Printf("  [%d] %s\n", i+1, fh.path)
+	}
+
+	printSignatures(headers)
+	printPresence(headers)
+	printHeaderChanges(headers)
+	return nil
+}
+
+// printSignatures groups files whose headers are identical, including order
+func printSignatures(headers []fileHeader) {
+	type signature struct {
+		header []string
+		files  []int
+	}
+	var sigs []*signature
+	byKey := map[string]*signature{}
+	for i, fh := range headers {
+		key := strings.Join(fh.header, "\x00")
+		s := byKey[key]
+		if s == nil {
+			s = &signature{header: fh.header}
+			byKey[key] = s
+			sigs = append(sigs, s)
+		}
+		s.files = append(s.files, i)
+	}
+
+	fmt.Printf("\nHeader signatures: %d\n", len(sigs))
+	for n, s := range sigs {
+		refs := make([]string, len(s.files))
+		for i, f := range s.files {
+			refs[i] = fmt.Sprintf("[%d]", f+1)
+		}
+		fmt.Printf("  #%d %s (%d columns): %s\n", n+1, strings.Join(refs, " "), len(s.header), strings.Join(s.header, ", "))
+	}
+}
+
+// printPresence prints a column-by-file matrix with ✓ where the file has
+// the column
+func printPresence(headers []fileHeader) {
+	var cols []string
+	seen := map[string]bool{}
+	for _, fh := range headers {
+		for _, h := range fh.header {
+			if !seen[h] {
+				seen[h] = true
+				cols = append(cols, h)
+			}
+		}
+	}
+
+	fmt.Printf("\nColumn presence:\n")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	fmt.Fprint(w, "  column")
+	for i := range headers {
+		fmt.Fprintf(w, "\t%d", i+1)
+	}
+	fmt.Fprint(w, "\tfiles\n")
+
+	for _, c := range cols {
+		fmt.Fprintf(w, "  %s", c)
+		n := 0
+		for _, fh := range headers {
+			if slices.Contains(fh.header, c) {
+				n++
+				fmt.Fprint(w, "\t✓")
+			} else {
+				fmt.Fprint(w, "\t·")
+			}
+		}
+		fmt.Fprintf(w, "\t%d/%d\n", n, len(headers))
+	}
+	w.Flush()
+}
+
+// printHeaderChanges compares each file's header with the previous file's
+func printHeaderChanges(headers []fileHeader) {
+	fmt.Printf("\nChanges:\n")
+	changed := false
+	for i := 1; i < len(headers); i++ {
+		prev, cur := headers[i-1].header, headers[i].header
+
+		var added, removed []string
+		for _, h := range cur {
+			if !slices.Contains(prev, h) {
+				added = append(added, h)
+			}
+		}
+		for _, h := range prev {
+			if !slices.Contains(cur, h) {
+				removed = append(removed, h)
+			}
+		}
+		moved := movedColumns(prev, cur)
+
+		if len(added) == 0 && len(removed) == 0 && len(moved) == 0 {
+			continue
+		}
+		changed = true
+		fmt.Printf("  [%d] → [%d] %s\n", i, i+1, headers[i].path)
+		if len(added) > 0 {
+			fmt.Printf("    + added:   %s\n", strings.Join(added, ", "))
+		}
+		if len(removed) > 0 {
+			fmt.Printf("    - removed: %s\n", strings.Join(removed, ", "))
+		}
+		if len(moved) > 0 {
+			fmt.Printf("    ↕ moved:   %s\n", strings.Join(moved, ", "))
+		}
+	}
+	if !changed {
+		fmt.Printf("  (none)\n")
+	}
+}
+
+// movedColumns returns columns common to both headers whose relative order
+// changed: those outside a longest common subsequence of the shared columns
+func movedColumns(prev, cur []string) []string {
+	var a, b []string
+	for _, h := range prev {
+		if slices.Contains(cur, h) {
+			a = append(a, h)
+		}
+	}
+	for _, h := range cur {
+		if slices.Contains(prev, h) {
+			b = append(b, h)
+		}
+	}
+	if slices.Equal(a, b) {
+		return nil
+	}
+
+	// lcs[i][j] is the LCS length of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	keep := map[string]bool{}
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] == b[j]:
+			keep[a[i]] = true
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+
+	var moved []string
+	for _, h := range b {
+		if !keep[h] {
+			moved = append(moved, h)
+		}
+	}
+	return moved
+}
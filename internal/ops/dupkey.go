@@ -1,193 +1,547 @@
 package ops
 
 import (
+	"encoding/csv"
 	"fmt"
 	"io"
 	"os"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/c-a-ray/dkit/internal/core"
 )
 
+// DupKeyOpts configures duplicate key detection
+// Keys names one or more columns that together identify a record
+// Similarity holds a method per BY column (SimNone compares exactly); when
+// any is set, a key whose tuples are all near-identical (field by field, at
+// Threshold or above, or each method's default if 0) is reported as a likely
+// typo rather than a conflict; Reverse instead finds BY-tuples that appear under more than one
+// key. MaxExamples caps the file:line locations shown per tuple, and Export
+// names a CSV file to receive every row of a reported key (or tuple)
 type DupKeyOpts struct {
-	Key        string
-	ByColumns  []string
-	IgnoreCase bool
-	RequireAll bool
-	NullToken  string
-	Quiet      bool
-	Config     *core.Config
+	Keys        []string
+	ByColumns   []string
+	IgnoreCase  bool
+	RequireAll  bool
+	NullToken   string
+	Similarity  []Similarity
+	Threshold   float64
+	Reverse     bool
+	MaxExamples int
+	Export      string
+	Quiet       bool
+	Config      *core.Config
 }
 
 type DupKeyResult struct {
 	FilesScanned    int
 	RowsSeen        int
 	ConflictingKeys int
+	TypoKeys        int
+	// ConflictingTuples counts BY-tuples seen under more than one key
+	// (Reverse only)
+	ConflictingTuples int
+	ExportedRows      int
+}
+
+// pairStats counts the rows carrying one key and tuple and keeps where the
+// first few of them were
+type pairStats struct {
+	count int
+	locs  []string
+}
+
+func (p *pairStats) add(path string, line, keep int) {
+	p.count++
+	if len(p.locs) < keep {
+		p.locs = append(p.locs, fmt.Sprintf("%s:%d", path, line))
+	}
+}
+
+// examples formats the kept locations as a bracketed suffix, noting how many
+// rows were left out; it is empty when none were kept
+func (p *pairStats) examples() string {
+	if len(p.locs) == 0 {
+		return ""
+	}
+	s := strings.Join(p.locs, ", ")
+	if more := p.count - len(p.locs); more > 0 {
+		s += fmt.Sprintf(", +%d more", more)
+	}
+	return "  [" + s + "]"
 }
 
 // DupKey finds keys that map to more than one distinct tuple of BY fields.
+// Keys and tuples are held packed (see packFields), so values containing any
+// separator still split back correctly
 func DupKey(files []string, o DupKeyOpts) (DupKeyResult, error) {
 	res := DupKeyResult{}
 	if len(files) == 0 {
 		return res, fmt.Errorf("no files")
 	}
 
-	keyToTuples := map[string]map[string]int{}
+	keyToTuples := map[string]map[string]*pairStats{}
+	width := 0
 
 	for _, path := range files {
-		rc, err := core.OpenWithEncoding(path, o.Config.Encoding)
+		rows, ok, err := scanDupKeyFile(path, o, func(rec []string, line int, key, tuple string) {
+			width = max(width, len(rec))
+			if keyToTuples[key] == nil {
+				keyToTuples[key] = map[string]*pairStats{}
+			}
+			ps := keyToTuples[key][tuple]
+			if ps == nil {
+				ps = &pairStats{}
+				keyToTuples[key][tuple] = ps
+			}
+			ps.add(path, line, o.MaxExamples)
+		})
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "[WARN] cannot read %s: %v\n", path, err)
-			continue
+			return res, err
 		}
-		cr := core.NewCSVReader(rc, o.Config.Delim, o.Config.LazyQuotes)
+		res.RowsSeen += rows
+		if ok {
+			res.FilesScanned++
+		}
+	}
 
-		var idxKey int
-		var idxBy []int
+	var match func(key, tuple string) bool
+	if o.Reverse {
+		tuples := reportReverse(keyToTuples, o, &res)
+		match = func(_, t string) bool { return tuples[t] }
+	} else {
+		keys := reportConflicts(keyToTuples, o, &res)
+		match = func(k, _ string) bool { return keys[k] }
+	}
 
-		if o.Config.NoHeader {
-			ki, err := parseIndex(o.Key)
+	if o.Export != "" {
+		n, err := exportDupRows(files, o, width, match)
+		if err != nil {
+			return res, err
+		}
+		res.ExportedRows = n
+		fmt.Fprintf(os.Stderr, "[INFO] wrote %d rows to %s\n", n, o.Export)
+	}
+
+	return res, nil
+}
+
+// scanDupKeyFile reads one file and calls fn with each usable row, its line,
+// and its normalized, packed key and BY-tuple; it returns the number of data
+// rows, and ok is false when the file was skipped with a warning
+func scanDupKeyFile(path string, o DupKeyOpts, fn func(rec []string, line int, key, tuple string)) (int, bool, error) {
+	rc, err := core.OpenWithEncoding(path, o.Config.Encoding)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[WARN] cannot read %s: %v\n", path, err)
+		return 0, false, nil
+	}
+	defer rc.Close()
+	cr := core.NewCSVReader(rc, o.Config.Delim, o.Config.LazyQuotes)
+
+	idxKeys := make([]int, len(o.Keys))
+	idxBy := make([]int, len(o.ByColumns))
+
+	if o.Config.NoHeader {
+		for i, s := range o.Keys {
+			idxKeys[i], err = parseIndex(s)
 			if err != nil {
-				rc.Close()
-				return res, fmt.Errorf("--no-header: key must be index: %w", err)
+				return 0, false, fmt.Errorf("--no-header: key[%d] must be index: %w", i, err)
 			}
-
-			idxKey = ki
-			idxBy = make([]int, len(o.ByColumns))
-			for i, s := range o.ByColumns {
-				vi, err := parseIndex(s)
-				if err != nil {
-					rc.Close()
-					return res, fmt.Errorf("--no-header: by[%d] must be index: %w", i, err)
-				}
-				idxBy[i] = vi
+		}
+		for i, s := range o.ByColumns {
+			idxBy[i], err = parseIndex(s)
+			if err != nil {
+				return 0, false, fmt.Errorf("--no-header: by[%d] must be index: %w", i, err)
 			}
-		} else {
-			hdr, err := cr.Read()
-			if err == io.EOF {
-				fmt.Fprintf(os.Stderr, "[WARN] %s is empty\n", path)
-				rc.Close()
-				continue
-			} else if err != nil {
+		}
+	} else {
+		hdr, err := cr.Read()
+		if err == io.EOF {
+			fmt.Fprintf(os.Stderr, "[WARN] %s is empty\n", path)
+			return 0, false, nil
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "[WARN] %s: %v\n", path, err)
+			return 0, false, nil
+		}
+		for i, name := range o.Keys {
+			idxKeys[i], err = resolveHeaderIndex(hdr, name)
+			if err != nil {
 				fmt.Fprintf(os.Stderr, "[WARN] %s: %v\n", path, err)
-				rc.Close()
-				continue
+				return 0, false, nil
 			}
-			ik, err := resolveHeaderIndex(hdr, o.Key)
+		}
+		for i, name := range o.ByColumns {
+			idxBy[i], err = resolveHeaderIndex(hdr, name)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "[WARN] %s: %v\n", path, err)
-				rc.Close()
-				continue
+				return 0, false, nil
 			}
-			idxKey = ik
-			idxBy = make([]int, len(o.ByColumns))
-			for i, name := range o.ByColumns {
-				j, err := resolveHeaderIndex(hdr, name)
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "[WARN] %s: %v\n", path, err)
-					rc.Close()
-					idxBy = nil
-					break
-				}
-				idxBy[i] = j
+		}
+	}
+
+	rows := 0
+	keys := make([]string, len(idxKeys))
+	vals := make([]string, len(idxBy))
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[WARN] %s: %v\n", path, err)
+			break
+		}
+		rows++
+
+		// Rows missing any part of the key cannot be attributed
+		missing := false
+		for i, j := range idxKeys {
+			if j >= len(rec) {
+				missing = true
+				break
 			}
-			if idxBy == nil {
-				continue
+			keys[i] = strings.TrimSpace(rec[j])
+			if keys[i] == "" {
+				missing = true
+				break
 			}
 		}
+		if missing {
+			continue
+		}
 
-		for {
-			rec, err := cr.Read()
-			if err == io.EOF {
+		for i, j := range idxBy {
+			if j >= len(rec) {
+				missing = true
 				break
 			}
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "[WARN] %s: %v\n", path, err)
+			v := strings.TrimSpace(rec[j])
+			if o.RequireAll && v == "" {
+				missing = true
 				break
 			}
-			res.RowsSeen++
+			if v == "" && !o.RequireAll && o.NullToken != "" {
+				v = o.NullToken
+			}
+			vals[i] = v
+		}
+		if missing {
+			continue
+		}
 
-			if idxKey >= len(rec) {
-				continue
+		if o.IgnoreCase {
+			for i := range keys {
+				keys[i] = strings.ToLower(keys[i])
 			}
-			key := strings.TrimSpace(rec[idxKey])
-			if key == "" {
-				continue
+			for i := range vals {
+				vals[i] = strings.ToLower(vals[i])
 			}
+		}
 
-			vals := make([]string, len(idxBy))
-			missing := false
-			for i, j := range idxBy {
-				if j >= len(rec) {
-					missing = true
-					break
-				}
-				v := strings.TrimSpace(rec[j])
-				if o.RequireAll && v == "" {
-					missing = true
-					break
-				}
-				if v == "" && !o.RequireAll && o.NullToken != "" {
-					v = o.NullToken
-				}
-				vals[i] = v
-			}
-			if missing {
+		line, _ := cr.FieldPos(idxKeys[0])
+		fn(rec, line, packFields(keys), packFields(vals))
+	}
+	return rows, true, nil
+}
+
+// reportConflicts prints each key carried by more than one BY-tuple, split
+// into conflicts and likely typos when a similarity is set, and returns the
+// reported keys
+func reportConflicts(keyToTuples map[string]map[string]*pairStats, o DupKeyOpts, res *DupKeyResult) map[string]bool {
+	keys := make([]string, 0, len(keyToTuples))
+	for k, m := range keyToTuples {
+		if len(m) > 1 {
+			keys = append(keys, k)
+		}
+	}
+	slices.SortFunc(keys, comparePacked)
+
+	var typos []string
+	for _, k := range keys {
+		m := keyToTuples[k]
+		out := sortedTuples(m)
+
+		var groups []int
+		if anySimilarity(o.Similarity) {
+			var n int
+			groups, n = groupSimilarTuples(out, o.Similarity, o.Threshold)
+			if n == 1 {
+				typos = append(typos, k)
 				continue
 			}
+		}
 
-			if o.IgnoreCase {
-				key = strings.ToLower(key)
-				for i := range vals {
-					vals[i] = strings.ToLower(vals[i])
+		res.ConflictingKeys++
+		if !o.Quiet {
+			if groups != nil {
+				fmt.Printf("KEY: %s  (%d distinct BY-tuples in %d groups)\n", formatKey(o.Keys, k), len(m), slices.Max(groups)+1)
+			} else {
+				fmt.Printf("KEY: %s  (%d distinct BY-tuples)\n", formatKey(o.Keys, k), len(m))
+			}
+			for i, p := range out {
+				parts := unpackFields(p.t)
+				if groups != nil {
+					fmt.Printf("  - [%d] (%s)  %d%s\n", groups[i]+1, joinKV(o.ByColumns, parts), p.c, m[p.t].examples())
+				} else {
+					fmt.Printf("  - (%s)  %d%s\n", joinKV(o.ByColumns, parts), p.c, m[p.t].examples())
 				}
 			}
+			fmt.Println()
+		}
+	}
 
-			tuple := strings.Join(vals, "||") // safe internal separator
-
-			if keyToTuples[key] == nil {
-				keyToTuples[key] = map[string]int{}
+	res.TypoKeys = len(typos)
+	if len(typos) > 0 && !o.Quiet {
+		fmt.Printf("Likely typos (all BY-tuples similar by %s):\n\n", describeSimilarity(o.ByColumns, o.Similarity))
+		for _, k := range typos {
+			m := keyToTuples[k]
+			fmt.Printf("KEY: %s  (%d similar BY-tuples)\n", formatKey(o.Keys, k), len(m))
+			for _, p := range sortedTuples(m) {
+				parts := unpackFields(p.t)
+				fmt.Printf("  ~ (%s)  %d%s\n", joinKV(o.ByColumns, parts), p.c, m[p.t].examples())
 			}
-			keyToTuples[key][tuple]++
+			fmt.Println()
 		}
+	}
 
-		rc.Close()
-		res.FilesScanned++
+	if anySimilarity(o.Similarity) {
+		fmt.Fprintf(os.Stderr, "\nScanned %d files, %d rows. Conflicting keys: %d, likely typos: %d\n",
+			res.FilesScanned, res.RowsSeen, res.ConflictingKeys, res.TypoKeys)
+	} else {
+		fmt.Fprintf(os.Stderr, "\nScanned %d files, %d rows. Conflicting keys: %d\n",
+			res.FilesScanned, res.RowsSeen, res.ConflictingKeys)
 	}
 
+	reported := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		reported[k] = true
+	}
+	return reported
+}
+
+// reportReverse prints each BY-tuple carried by more than one key, with the
+// keys, their row counts, and where those rows were; it returns the
+// reported tuples
+func reportReverse(keyToTuples map[string]map[string]*pairStats, o DupKeyOpts, res *DupKeyResult) map[string]bool {
+	tupleToKeys := map[string]map[string]*pairStats{}
 	for k, m := range keyToTuples {
-		if len(m) <= 1 {
+		for t, ps := range m {
+			if tupleToKeys[t] == nil {
+				tupleToKeys[t] = map[string]*pairStats{}
+			}
+			tupleToKeys[t][k] = ps
+		}
+	}
+
+	reported := map[string]bool{}
+	for t, m := range tupleToKeys {
+		if len(m) > 1 {
+			reported[t] = true
+		}
+	}
+	tuples := make([]string, 0, len(reported))
+	for t := range reported {
+		tuples = append(tuples, t)
+	}
+	slices.SortFunc(tuples, comparePacked)
+
+	res.ConflictingTuples = len(tuples)
+	if !o.Quiet {
+		for _, t := range tuples {
+			m := tupleToKeys[t]
+			parts := unpackFields(t)
+			fmt.Printf("TUPLE: (%s)  (%d distinct keys)\n", joinKV(o.ByColumns, parts), len(m))
+			for _, p := range sortedTuples(m) {
+				fmt.Printf("  - %s  %d%s\n", joinKV(o.Keys, unpackFields(p.t)), p.c, m[p.t].examples())
+			}
+			fmt.Println()
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "\nScanned %d files, %d rows. Tuples under multiple keys: %d\n",
+		res.FilesScanned, res.RowsSeen, res.ConflictingTuples)
+	return reported
+}
+
+// exportDupRows rereads the files and writes every row whose key and tuple
+// match to o.Export as CSV, prefixed with its file and line
+// Columns are the union of the files' headers by name (a repeated name keeps
+// its repeats), or width positions with --no-header
+func exportDupRows(files []string, o DupKeyOpts, width int, match func(key, tuple string) bool) (int, error) {
+	// First collect the output columns so every row lines up
+	var columns []string
+	slot := map[string]int{}
+	layouts := map[string][]int{}
+	for _, path := range files {
+		if o.Config.NoHeader {
+			break
+		}
+		rc, err := core.OpenWithEncoding(path, o.Config.Encoding)
+		if err != nil {
 			continue
 		}
-		res.ConflictingKeys++
-		if !o.Quiet {
-			fmt.Printf("KEY: %s  (%d distinct BY-tuples)\n", k, len(m))
-			// stable-ish order: by count desc, then tuple asc
-			type pair struct {
-				t string
-				c int
-			}
-			out := make([]pair, 0, len(m))
-			for t, c := range m {
-				out = append(out, pair{t, c})
-			}
-			sort.Slice(out, func(i, j int) bool {
-				if out[i].c == out[j].c {
-					return out[i].t < out[j].t
+		cr := core.NewCSVReader(rc, o.Config.Delim, o.Config.LazyQuotes)
+		hdr, err := cr.Read()
+		rc.Close()
+		if err != nil {
+			continue
+		}
+		seen := map[string]int{}
+		layout := make([]int, len(hdr))
+		for i, name := range hdr {
+			id := name + "\x00" + strconv.Itoa(seen[name])
+			seen[name]++
+			j, ok := slot[id]
+			if !ok {
+				j = len(columns)
+				slot[id] = j
+				columns = append(columns, name)
+			}
+			layout[i] = j
+		}
+		layouts[path] = layout
+	}
+	if o.Config.NoHeader {
+		for i := range width {
+			columns = append(columns, strconv.Itoa(i))
+		}
+	}
+
+	f, err := os.Create(o.Export)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	if err := w.Write(append([]string{"file", "line"}, columns...)); err != nil {
+		return 0, fmt.Errorf("write %s: %w", o.Export, err)
+	}
+
+	n := 0
+	out := make([]string, 2+len(columns))
+	for _, path := range files {
+		layout := layouts[path]
+		var werr error
+		_, _, err := scanDupKeyFile(path, o, func(rec []string, line int, key, tuple string) {
+			if werr != nil || !match(key, tuple) {
+				return
+			}
+			clear(out)
+			out[0], out[1] = path, strconv.Itoa(line)
+			for i, v := range rec {
+				switch {
+				case o.Config.NoHeader:
+					out[2+i] = v
+				case i < len(layout):
+					out[2+layout[i]] = v
 				}
-				return out[i].c > out[j].c
-			})
-			for _, p := range out {
-				parts := strings.Split(p.t, "||")
-				fmt.Printf("  - (%s)  %d\n", joinKV(o.ByColumns, parts), p.c)
 			}
-			fmt.Println()
+			werr = w.Write(out)
+			n++
+		})
+		if err != nil {
+			return n, err
 		}
+		if werr != nil {
+			return n, fmt.Errorf("write %s: %w", o.Export, werr)
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return n, fmt.Errorf("write %s: %w", o.Export, err)
+	}
+	return n, f.Close()
+}
+
+// formatKey shows a packed key as its value, or as name="value" pairs when
+// it spans several columns
+func formatKey(names []string, k string) string {
+	parts := unpackFields(k)
+	if len(parts) == 1 {
+		return parts[0]
 	}
+	return "(" + joinKV(names, parts) + ")"
+}
 
-	fmt.Fprintf(os.Stderr, "\nScanned %d files, %d rows. Conflicting keys: %d\n",
-		res.FilesScanned, res.RowsSeen, res.ConflictingKeys)
+// comparePacked orders packed keys field by field
+func comparePacked(a, b string) int {
+	return slices.Compare(unpackFields(a), unpackFields(b))
+}
 
-	return res, nil
+// tupleCount is a BY-tuple (or, in reverse, a key) with how many rows
+// carried it
+type tupleCount struct {
+	t string
+	c int
+}
+
+// sortedTuples orders tuples by count descending, then tuple
+func sortedTuples(m map[string]*pairStats) []tupleCount {
+	out := make([]tupleCount, 0, len(m))
+	for t, ps := range m {
+		out = append(out, tupleCount{t, ps.count})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].c == out[j].c {
+			return comparePacked(out[i].t, out[j].t) < 0
+		}
+		return out[i].c > out[j].c
+	})
+	return out
+}
+
+// groupSimilarTuples links tuples whose fields are all similar, each by its
+// own method, and returns
+// each tuple's group (numbered in order of first appearance) and the
+// number of groups
+func groupSimilarTuples(tuples []tupleCount, sims []Similarity, threshold float64) ([]int, int) {
+	parent := make([]int, len(tuples))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	fields := make([][]string, len(tuples))
+	for i, t := range tuples {
+		fields[i] = unpackFields(t.t)
+	}
+	for i := range tuples {
+		for j := i + 1; j < len(tuples); j++ {
+			if find(i) == find(j) {
+				continue
+			}
+			similar := true
+			for f := range fields[i] {
+				if !sims[f].similar(fields[i][f], fields[j][f], threshold) {
+					similar = false
+					break
+				}
+			}
+			if similar {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	groups := make([]int, len(tuples))
+	ids := map[int]int{}
+	for i := range tuples {
+		root := find(i)
+		id, ok := ids[root]
+		if !ok {
+			id = len(ids)
+			ids[root] = id
+		}
+		groups[i] = id
+	}
+	return groups, len(ids)
 }
@@ -1,31 +1,59 @@
 package ops
 
 import (
+	"encoding/csv"
 	"fmt"
 	"io"
 	"os"
-	"strconv"
+	"regexp"
 	"strings"
 
 	"github.com/c-a-ray/dkit/internal/core"
 )
 
-// FilesWithOpts configures how to search files for a column/value match
+// FilesWithOpts configures how to search files for matching rows
+// A row matches when Column equals Value (or matches it as a pattern with
+// Regex) and Filter passes; an empty Column leaves the filter alone. Count
+// prints each file's number of matching rows, Invert lists the files with
+// none, and Rows prints the matching rows themselves
 type FilesWithOpts struct {
 	Column          string
 	Value           string
+	Regex           bool
 	CaseInsensitive bool
+	Filter          Filter
+	Count           bool
+	Invert          bool
+	Rows            bool
 	Config          *core.Config
 }
 
 // FilesWith scans the given CSV files and prints the path of each file that
-// contains at least one row where Column equals Value
+// contains at least one matching row; it returns how many files were
+// reported (files without matches, with Invert)
 func FilesWith(files []string, o FilesWithOpts) (int, error) {
-	printed := 0
+	var re *regexp.Regexp
 	want := o.Value
-	if o.CaseInsensitive {
+	if o.Column != "" && o.Regex {
+		pat := o.Value
+		if o.CaseInsensitive {
+			pat = "(?i)" + pat
+		}
+		var err error
+		re, err = regexp.Compile(pat)
+		if err != nil {
+			return 0, fmt.Errorf("invalid pattern %q: %w", o.Value, err)
+		}
+	} else if o.CaseInsensitive {
 		want = strings.ToLower(want)
 	}
+
+	// Rows are re-encoded one at a time so each can carry a path:line prefix
+	var rowBuf strings.Builder
+	rowOut := csv.NewWriter(&rowBuf)
+	rowOut.Comma = o.Config.Delim
+
+	printed := 0
 	for _, path := range files {
 		rc, err := core.OpenWithEncoding(path, o.Config.Encoding)
 		if err != nil {
@@ -34,40 +62,56 @@ func FilesWith(files []string, o FilesWithOpts) (int, error) {
 		}
 		cr := core.NewCSVReader(rc, o.Config.Delim, o.Config.LazyQuotes)
 
-		var idx int
+		idx := -1
+		var resolvedFilter ResolvedFilter
+		// An empty file, or one without the columns, has no matching rows:
+		// it is still reported by Count and Invert
+		noRows := false
 		if o.Config.NoHeader {
-			idx, err = strconv.Atoi(o.Column)
-			if err != nil || idx < 0 {
-				rc.Close()
-				return printed, fmt.Errorf("--no-header requires numeric index, got %q", o.Column)
+			if o.Column != "" {
+				idx, err = parseIndex(o.Column)
+				if err != nil {
+					rc.Close()
+					return printed, fmt.Errorf("--no-header requires numeric index, got %q", o.Column)
+				}
+			}
+			if !o.Filter.IsEmpty() {
+				resolvedFilter, err = o.Filter.Resolve(nil, true)
+				if err != nil {
+					rc.Close()
+					return printed, err
+				}
 			}
 		} else {
 			hdr, err := cr.Read()
-			if err == io.EOF {
-				rc.Close()
-				continue
-			}
-			if err != nil {
+			switch {
+			case err == io.EOF:
+				noRows = true
+			case err != nil:
 				fmt.Fprintf(os.Stderr, "[WARN] %s: %v\n", path, err)
 				rc.Close()
 				continue
 			}
-			idx = -1
-			for i, h := range hdr {
-				if h == o.Column {
-					idx = i
-					break
+			if !noRows && o.Column != "" {
+				idx, err = resolveHeaderIndex(hdr, o.Column)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "[WARN] %s: %v\n", path, err)
+					noRows = true
 				}
 			}
-			if idx < 0 {
-				fmt.Fprintf(os.Stderr, "[WARN] %s: header %q not found\n", path, o.Column)
-				rc.Close()
-				continue
+			if !noRows && !o.Filter.IsEmpty() {
+				resolvedFilter, err = o.Filter.Resolve(hdr, false)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "[WARN] %s: %v\n", path, err)
+					noRows = true
+				}
 			}
 		}
 
-		matched := false
-		for {
+		// Without Count or Rows the first match settles the file
+		settle := !o.Count && !o.Rows
+		matches := 0
+		for !noRows {
 			rec, err := cr.Read()
 			if err == io.EOF {
 				break
@@ -76,22 +120,64 @@ func FilesWith(files []string, o FilesWithOpts) (int, error) {
 				fmt.Fprintf(os.Stderr, "[WARN] %s: %v\n", path, err)
 				break
 			}
-			if idx >= len(rec) {
+			if idx >= 0 {
+				if idx >= len(rec) {
+					continue
+				}
+				v := strings.TrimSpace(rec[idx])
+				if re != nil {
+					if !re.MatchString(v) {
+						continue
+					}
+				} else {
+					if o.CaseInsensitive {
+						v = strings.ToLower(v)
+					}
+					if v != want {
+						continue
+					}
+				}
+			}
+			if !resolvedFilter.Match(rec) {
 				continue
 			}
-			v := strings.TrimSpace(rec[idx])
-			if o.CaseInsensitive {
-				v = strings.ToLower(v)
+
+			matches++
+			if o.Rows {
+				line, _ := cr.FieldPos(0)
+				rowBuf.Reset()
+				if err := rowOut.Write(rec); err != nil {
+					rc.Close()
+					return printed, fmt.Errorf("write: %w", err)
+				}
+				rowOut.Flush()
+				fmt.Printf("%s:%d: %s", path, line, rowBuf.String())
 			}
-			if v == want {
-				fmt.Println(path)
-				printed++
-				matched = true
+			if settle {
 				break
 			}
 		}
 		rc.Close()
-		_ = matched
+
+		switch {
+		case o.Count:
+			fmt.Printf("%s: %d\n", path, matches)
+			if matches > 0 {
+				printed++
+			}
+		case o.Rows:
+			if matches > 0 {
+				printed++
+			}
+		case o.Invert:
+			if matches == 0 {
+				fmt.Println(path)
+				printed++
+			}
+		case matches > 0:
+			fmt.Println(path)
+			printed++
+		}
 	}
 	return printed, nil
 }
@@ -2,6 +2,7 @@ package ops
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 )
 
@@ -13,6 +14,8 @@ const (
 	OpNotEqual                 // !=
 	OpEmpty                    // is empty
 	OpNotEmpty                 // not empty
+	OpMatch                    // ~ (regular expression)
+	OpNotMatch                 // !~
 )
 
 // Clause represents a single condition: Column Op Value
@@ -20,6 +23,7 @@ type Clause struct {
 	Column string
 	Op     FilterOp
 	Value  string // unused for OpEmpty/OpNotEmpty
+	re     *regexp.Regexp
 }
 
 // ResolvedClause is a Clause with column index resolved
@@ -27,6 +31,7 @@ type ResolvedClause struct {
 	Index int
 	Op    FilterOp
 	Value string
+	re    *regexp.Regexp
 }
 
 // Disjunction is a group of clauses ORed together (from one --when flag)
@@ -63,11 +68,12 @@ func ParseWhenFlags(whens []string) (Filter, error) {
 	return f, nil
 }
 
-// parseDisjunction parses a single --when value which may contain "|" for OR
+// parseDisjunction parses a single --when value which may contain "|" for OR;
+// "\|" stands for a literal pipe, and a "|" inside the parentheses or
+// brackets of a regex operand belongs to the pattern
 func parseDisjunction(s string) (Disjunction, error) {
 	d := Disjunction{}
-	parts := strings.Split(s, "|")
-	for _, p := range parts {
+	for _, p := range splitDisjunction(s) {
 		p = strings.TrimSpace(p)
 		if p == "" {
 			continue
@@ -84,37 +90,130 @@ func parseDisjunction(s string) (Disjunction, error) {
 	return d, nil
 }
 
-// parseClause parses a single condition like "B=dog", "B!=cat", "B is empty", "B not empty"
+// splitDisjunction splits s into clauses at each "|" that is not escaped
+// and not inside a group or character class of a regex operand, dropping
+// the backslash from escaped pipes
+func splitDisjunction(s string) []string {
+	var parts []string
+	var cur strings.Builder
+	// inRegex is set once the current clause reaches a ~ operator, as
+	// parseClause decides it
+	inRegex, inClass, depth := false, false, 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && s[i+1] == '|':
+			cur.WriteByte('|')
+			i++
+			continue
+		case c == '\\' && i+1 < len(s) && (inRegex || s[i+1] == '~'):
+			cur.WriteByte(c)
+			cur.WriteByte(s[i+1])
+			i++
+			continue
+		case c == '|' && depth == 0 && !inClass:
+			parts = append(parts, cur.String())
+			cur.Reset()
+			inRegex = false
+			continue
+		}
+		cur.WriteByte(c)
+		switch {
+		case !inRegex:
+			inRegex = c == '~' && !strings.Contains(cur.String(), "=")
+		case inClass:
+			inClass = c != ']'
+		case c == '[':
+			inClass = true
+			// A leading ] (after an optional ^) is part of the class
+			if i+1 < len(s) && s[i+1] == '^' {
+				cur.WriteByte('^')
+				i++
+			}
+			if i+1 < len(s) && s[i+1] == ']' {
+				cur.WriteByte(']')
+				i++
+			}
+		case c == '(':
+			depth++
+		case c == ')' && depth > 0:
+			depth--
+		}
+	}
+	return append(parts, cur.String())
+}
+
+// unescapeColumn turns "\~" in a clause's column name back into "~"
+func unescapeColumn(s string) string {
+	return strings.ReplaceAll(strings.TrimSpace(s), `\~`, "~")
+}
+
+// regexOpIndex returns the position of the first ~ not escaped with a
+// backslash, or -1
+func regexOpIndex(s string) int {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) && s[i+1] == '~' {
+				i++
+			}
+		case '~':
+			return i
+		}
+	}
+	return -1
+}
+
+// parseClause parses a single condition like "B=dog", "B!=cat", "B~^d",
+// "B!~^c", "B is empty", "B not empty"; a column name containing ~ writes
+// it as "\~"
 func parseClause(s string) (Clause, error) {
 	lower := strings.ToLower(s)
 
 	// Check for "is empty" (case insensitive)
 	if idx := strings.Index(lower, " is empty"); idx > 0 {
-		col := strings.TrimSpace(s[:idx])
+		col := unescapeColumn(s[:idx])
 		return Clause{Column: col, Op: OpEmpty}, nil
 	}
 
 	// Check for "not empty" (case insensitive)
 	if idx := strings.Index(lower, " not empty"); idx > 0 {
-		col := strings.TrimSpace(s[:idx])
+		col := unescapeColumn(s[:idx])
 		return Clause{Column: col, Op: OpNotEmpty}, nil
 	}
 
+	// A regex operator before any = owns the rest of the clause, so patterns
+	// may contain = and !=
+	if idx := regexOpIndex(s); idx > 0 && !strings.Contains(s[:idx], "=") {
+		op := OpMatch
+		col := s[:idx]
+		if strings.HasSuffix(col, "!") {
+			op, col = OpNotMatch, col[:len(col)-1]
+		}
+		col = unescapeColumn(col)
+		val := strings.TrimSpace(s[idx+1:])
+		re, err := regexp.Compile(val)
+		if err != nil {
+			return Clause{}, fmt.Errorf("invalid pattern in %q: %w", s, err)
+		}
+		return Clause{Column: col, Op: op, Value: val, re: re}, nil
+	}
+
 	// Check for != before = (order matters)
 	if idx := strings.Index(s, "!="); idx > 0 {
-		col := strings.TrimSpace(s[:idx])
+		col := unescapeColumn(s[:idx])
 		val := strings.TrimSpace(s[idx+2:])
 		return Clause{Column: col, Op: OpNotEqual, Value: val}, nil
 	}
 
 	// Check for =
 	if idx := strings.Index(s, "="); idx > 0 {
-		col := strings.TrimSpace(s[:idx])
+		col := unescapeColumn(s[:idx])
 		val := strings.TrimSpace(s[idx+1:])
 		return Clause{Column: col, Op: OpEqual, Value: val}, nil
 	}
 
-	return Clause{}, fmt.Errorf("invalid condition %q (expected COL=VAL, COL!=VAL, COL is empty, or COL not empty)", s)
+	return Clause{}, fmt.Errorf("invalid condition %q (expected COL=VAL, COL!=VAL, COL~REGEX, COL!~REGEX, COL is empty, or COL not empty)", s)
 }
 
 // IsEmpty returns true if the filter has no conditions
@@ -147,6 +246,7 @@ func (f Filter) Resolve(header []string, noHeader bool) (ResolvedFilter, error)
 				Index: idx,
 				Op:    c.Op,
 				Value: c.Value,
+				re:    c.re,
 			})
 		}
 		rf.Groups = append(rf.Groups, rd)
@@ -197,6 +297,10 @@ func (rc ResolvedClause) match(rec []string) bool {
 		return val == ""
 	case OpNotEmpty:
 		return val != ""
+	case OpMatch:
+		return rc.re.MatchString(val)
+	case OpNotMatch:
+		return !rc.re.MatchString(val)
 	default:
 		return false
 	}
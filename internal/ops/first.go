@@ -4,21 +4,38 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"strconv"
+	"slices"
 	"strings"
 
 	"github.com/c-a-ray/dkit/internal/core"
 )
 
 // FirstOpts configures how the first non-empty value is searched
+// N is how many distinct non-empty values to print per file; Last takes
+// them from the end of the file instead; With names other columns to print
+// from the same row
 type FirstOpts struct {
-	Column string
-	Config *core.Config
+	Column   string
+	N        int
+	Last     bool
+	ShowLine bool
+	With     []string
+	Filter   Filter
+	Config   *core.Config
+}
+
+// firstHit is a value with the line and context columns of the row it came
+// from
+type firstHit struct {
+	value string
+	line  int
+	with  []string
 }
 
 // FirstNonEmpty scans the given files and prints the first non-empty value
 // found in the specified column of each file
 func FirstNonEmpty(files []string, o FirstOpts) (int, error) {
+	n := max(o.N, 1)
 	printed := 0
 	for _, path := range files {
 		rc, err := core.OpenWithEncoding(path, o.Config.Encoding)
@@ -27,13 +44,31 @@ func FirstNonEmpty(files []string, o FirstOpts) (int, error) {
 			continue
 		}
 		cr := core.NewCSVReader(rc, o.Config.Delim, o.Config.LazyQuotes)
+
 		var idx int
+		withIdx := make([]int, len(o.With))
+		var resolvedFilter ResolvedFilter
+
 		if o.Config.NoHeader {
-			idx, err = strconv.Atoi(o.Column)
-			if err != nil || idx < 0 {
+			idx, err = parseIndex(o.Column)
+			if err != nil {
 				rc.Close()
 				return printed, fmt.Errorf("--no-header requires numeric index, got %q", o.Column)
 			}
+			for i, c := range o.With {
+				withIdx[i], err = parseIndex(c)
+				if err != nil {
+					rc.Close()
+					return printed, fmt.Errorf("--no-header requires numeric --with indexes, got %q", c)
+				}
+			}
+			if !o.Filter.IsEmpty() {
+				resolvedFilter, err = o.Filter.Resolve(nil, true)
+				if err != nil {
+					rc.Close()
+					return printed, err
+				}
+			}
 		} else {
 			hdr, err := cr.Read()
 			if err == io.EOF {
@@ -45,20 +80,38 @@ func FirstNonEmpty(files []string, o FirstOpts) (int, error) {
 				rc.Close()
 				continue
 			}
-			idx = -1
-			for i, h := range hdr {
-				if h == o.Column {
-					idx = i
+			idx, err = resolveHeaderIndex(hdr, o.Column)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "[WARN] %s: %v\n", path, err)
+				rc.Close()
+				continue
+			}
+			missing := false
+			for i, c := range o.With {
+				withIdx[i], err = resolveHeaderIndex(hdr, c)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "[WARN] %s: %v\n", path, err)
+					missing = true
 					break
 				}
 			}
-			if idx < 0 {
-				fmt.Fprintf(os.Stderr, "[WARN] %s: header %q not found\n", path, o.Column)
+			if missing {
 				rc.Close()
 				continue
 			}
+			if !o.Filter.IsEmpty() {
+				resolvedFilter, err = o.Filter.Resolve(hdr, false)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "[WARN] %s: %v\n", path, err)
+					rc.Close()
+					continue
+				}
+			}
 		}
-		found := false
+
+		// hits holds up to n distinct values; with Last, a repeated value
+		// moves to the end so the oldest is evicted first
+		var hits []firstHit
 		for {
 			rec, err := cr.Read()
 			if err == io.EOF {
@@ -68,19 +121,52 @@ func FirstNonEmpty(files []string, o FirstOpts) (int, error) {
 				fmt.Fprintf(os.Stderr, "[WARN] %s: %v\n", path, err)
 				break
 			}
-			if idx >= len(rec) {
+			if idx >= len(rec) || !resolvedFilter.Match(rec) {
 				continue
 			}
 			v := strings.TrimSpace(rec[idx])
-			if v != "" {
-				fmt.Printf("%s: %s\n", path, v)
-				printed++
-				found = true
+			if v == "" {
+				continue
+			}
+
+			at := slices.IndexFunc(hits, func(h firstHit) bool { return h.value == v })
+			if at >= 0 && !o.Last {
+				continue
+			}
+
+			line, _ := cr.FieldPos(idx)
+			hit := firstHit{value: v, line: line, with: make([]string, len(withIdx))}
+			for i, j := range withIdx {
+				if j < len(rec) {
+					hit.with[i] = rec[j]
+				}
+			}
+
+			if at >= 0 {
+				hits = slices.Delete(hits, at, at+1)
+			}
+			hits = append(hits, hit)
+			if len(hits) > n {
+				hits = hits[1:]
+			}
+			if !o.Last && len(hits) == n {
 				break
 			}
 		}
 		rc.Close()
-		_ = found
+
+		for _, h := range hits {
+			loc := path
+			if o.ShowLine {
+				loc = fmt.Sprintf("%s:%d", path, h.line)
+			}
+			if len(o.With) > 0 {
+				fmt.Printf("%s: %s [%s]\n", loc, h.value, joinKV(o.With, h.with))
+			} else {
+				fmt.Printf("%s: %s\n", loc, h.value)
+			}
+			printed++
+		}
 	}
 	return printed, nil
 }
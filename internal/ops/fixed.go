@@ -0,0 +1,131 @@
+package ops
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// FixedField is a named character range of a fixed-width line
+// Start and End are 1-based and inclusive, counted in characters (runes)
+// after decoding, so multi-byte characters do not shift later fields
+type FixedField struct {
+	Name  string
+	Start int
+	End   int
+}
+
+// ParseFixedFields parses a comma-separated list of NAME=START:END ranges;
+// a single range may omit its name and is then called defaultName
+func ParseFixedFields(spec, defaultName string) ([]FixedField, error) {
+	parts := strings.Split(spec, ",")
+	fields := make([]FixedField, 0, len(parts))
+	seen := map[string]bool{}
+	for _, p := range parts {
+		p = strings.TrimSpace(p)
+		name, rng, named := strings.Cut(p, "=")
+		if !named {
+			if len(parts) > 1 {
+				return nil, fmt.Errorf("fixed-width range %q needs a name (NAME=START:END) when several are given", p)
+			}
+			name, rng = defaultName, p
+		}
+		name = strings.TrimSpace(name)
+
+		a, b, ok := strings.Cut(rng, ":")
+		start, err1 := strconv.Atoi(strings.TrimSpace(a))
+		end, err2 := strconv.Atoi(strings.TrimSpace(b))
+		if !ok || err1 != nil || err2 != nil || start < 1 || end < start {
+			return nil, fmt.Errorf("fixed-width range %q: expected START:END with 1 <= START <= END", p)
+		}
+		if name == "" {
+			return nil, fmt.Errorf("fixed-width range %q: empty name", p)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("fixed-width field %q defined twice", name)
+		}
+		seen[name] = true
+		fields = append(fields, FixedField{Name: name, Start: start, End: end})
+	}
+	return fields, nil
+}
+
+// rowReader yields records, header first, from a delimited or fixed-width file
+type rowReader interface {
+	Read() ([]string, error)
+}
+
+// fixedReader splits decoded lines into fields so fixed-width files can be
+// read like delimited ones: the first Read returns the field names as a
+// header, and each later Read returns one line's trimmed fields
+// Blank lines are skipped; fields starting past the end of a line are empty,
+// and reaches tells callers which fields the current line actually covers,
+// so short lines such as header and trailer records can be skipped
+type fixedReader struct {
+	s          *bufio.Scanner
+	fields     []FixedField
+	rec        []string
+	runes      int
+	headerSent bool
+}
+
+func newFixedReader(r io.Reader, fields []FixedField) *fixedReader {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	return &fixedReader{s: s, fields: fields, rec: make([]string, len(fields))}
+}
+
+func (f *fixedReader) Read() ([]string, error) {
+	if !f.headerSent {
+		f.headerSent = true
+		hdr := make([]string, len(f.fields))
+		for i, fd := range f.fields {
+			hdr[i] = fd.Name
+		}
+		return hdr, nil
+	}
+
+	for f.s.Scan() {
+		line := f.s.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		f.runes = utf8.RuneCountInString(line)
+		for i, fd := range f.fields {
+			f.rec[i] = strings.TrimSpace(runeSlice(line, fd.Start-1, fd.End))
+		}
+		return f.rec, nil
+	}
+	if err := f.s.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// reaches reports whether the last line read extends to field i
+func (f *fixedReader) reaches(i int) bool {
+	return f.fields[i].Start <= f.runes
+}
+
+// runeSlice returns the characters of s in [from, to), clamped to s
+func runeSlice(s string, from, to int) string {
+	start, end := len(s), len(s)
+	n := 0
+	for i := range s {
+		if n == from {
+			start = i
+		}
+		if n == to {
+			end = i
+			break
+		}
+		n++
+	}
+	if start > end {
+		return ""
+	}
+	return s[start:end]
+}
@@ -0,0 +1,242 @@
+package ops
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// valueType is a semantic type inferred from cell values
+type valueType int
+
+const (
+	typeBoolean valueType = iota
+	typeDate
+	typeDatetime
+	typeInteger
+	typeDecimal
+	typeZIP
+	typePhone
+	typeEmail
+	typeText
+	numValueTypes
+)
+
+// inferOrder is the order types are tried when inferring a column type,
+// most specific first; text always matches
+var inferOrder = []valueType{
+	typeBoolean, typeDate, typeDatetime, typeInteger, typeZIP,
+	typePhone, typeDecimal, typeEmail, typeText,
+}
+
+// exactShapes are formats whose values may also parse as integers; one is
+// chosen over integer only when every value has its shape and there is
+// evidence beyond the digit count, since 5- and 10-digit IDs are common: a
+// value that is not a plain integer (a leading zero, ZIP+4, or phone
+// punctuation), or a column name from shapeNames
+var exactShapes = []valueType{typeZIP, typePhone}
+
+var shapeNames = map[valueType][]string{
+	typeZIP:   {"zip", "postal"},
+	typePhone: {"phone", "tel", "fax", "mobile", "cell"},
+}
+
+// nameSuggests reports whether a column name hints at type t
+func nameSuggests(t valueType, name string) bool {
+	name = strings.ToLower(name)
+	for _, w := range shapeNames[t] {
+		if strings.Contains(name, w) {
+			return true
+		}
+	}
+	return false
+}
+
+var valueTypeNames = [...]string{
+	typeBoolean:  "boolean",
+	typeDate:     "date",
+	typeDatetime: "datetime",
+	typeInteger:  "integer",
+	typeDecimal:  "decimal",
+	typeZIP:      "zip",
+	typePhone:    "phone",
+	typeEmail:    "email",
+	typeText:     "text",
+}
+
+func (t valueType) String() string {
+	if t < 0 || t >= numValueTypes {
+		return "unknown"
+	}
+	return valueTypeNames[t]
+}
+
+// parseValueType maps a type name back to a valueType
+func parseValueType(s string) (valueType, error) {
+	name := strings.ToLower(strings.TrimSpace(s))
+	switch name {
+	case "string", "free text":
+		name = "text"
+	case "int":
+		name = "integer"
+	case "number", "float":
+		name = "decimal"
+	case "bool":
+		name = "boolean"
+	}
+	for t, n := range valueTypeNames {
+		if n == name {
+			return valueType(t), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown type %q (expected one of %s)", s, strings.Join(valueTypeNames[:], ", "))
+}
+
+var (
+	reInteger = regexp.MustCompile(`^[+-]?(0|[1-9][0-9]*)$`)
+	reDecimal = regexp.MustCompile(`^[+-]?\$?([0-9]{1,3}(,[0-9]{3})+|[0-9]+)?(\.[0-9]+)?$`)
+	reZIP     = regexp.MustCompile(`^[0-9]{5}(-?[0-9]{4})?$`)
+	rePhone   = regexp.MustCompile(`^(\+?1[ .-]?)?(\([0-9]{3}\)|[0-9]{3})[ .-]?[0-9]{3}[ .-]?[0-9]{4}$`)
+	reEmail   = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[A-Za-z]{2,}$`)
+)
+
+var booleanWords = map[string]bool{
+	"true": true, "false": true, "t": true, "f": true,
+	"yes": true, "no": true, "y": true, "n": true,
+	"0": true, "1": true,
+}
+
+var dateLayouts = []string{
+	"2006-01-02",
+	"01/02/2006",
+	"1/2/2006",
+	"01-02-2006",
+	"20060102",
+	"2006/01/02",
+}
+
+var datetimeLayouts = []string{
+	time.RFC3339,
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04",
+	"01/02/2006 15:04:05",
+	"01/02/2006 15:04",
+	"1/2/2006 15:04:05",
+	"1/2/2006 15:04",
+	"1/2/2006 3:04:05 PM",
+	"1/2/2006 3:04 PM",
+}
+
+// valueTypeMatches reports whether a non-empty, trimmed value is valid for t
+func valueTypeMatches(t valueType, v string) bool {
+	switch t {
+	case typeBoolean:
+		return booleanWords[strings.ToLower(v)]
+	case typeDate:
+		return parsesAsDate(v, dateLayouts)
+	case typeDatetime:
+		return parsesAsDate(v, datetimeLayouts)
+	case typeInteger:
+		return reInteger.MatchString(v)
+	case typeDecimal:
+		if !reDecimal.MatchString(v) || !strings.ContainsAny(v, "0123456789") {
+			return false
+		}
+		_, ok := parseNumber(strings.TrimLeft(v, "+-"))
+		return ok
+	case typeZIP:
+		return reZIP.MatchString(v)
+	case typePhone:
+		return rePhone.MatchString(v)
+	case typeEmail:
+		return reEmail.MatchString(v)
+	case typeText:
+		return true
+	default:
+		return false
+	}
+}
+
+// parsesAsDate tries each layout, rejecting implausible years so that
+// 8-digit identifiers are not mistaken for YYYYMMDD dates
+func parsesAsDate(v string, layouts []string) bool {
+	if len(v) < 6 || len(v) > 35 {
+		return false
+	}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, v); err == nil {
+			y := t.Year()
+			return y >= 1800 && y <= 2200
+		}
+	}
+	return false
+}
+
+// typeTally counts how many non-empty values match each type and keeps a
+// few examples of values that do not; formatted counts values matching a
+// type that are not plain integers
+type typeTally struct {
+	nonEmpty   int64
+	matches    [numValueTypes]int64
+	formatted  [numValueTypes]int64
+	mismatches [numValueTypes][]string
+}
+
+// maxTypeSamples caps how many mismatching values are kept per type
+const maxTypeSamples = 5
+
+func (t *typeTally) add(v string) {
+	t.nonEmpty++
+	plain := valueTypeMatches(typeInteger, v)
+	for vt := range numValueTypes {
+		if valueTypeMatches(vt, v) {
+			t.matches[vt]++
+			if !plain {
+				t.formatted[vt]++
+			}
+		} else if len(t.mismatches[vt]) < maxTypeSamples && !containsString(t.mismatches[vt], v) {
+			t.mismatches[vt] = append(t.mismatches[vt], v)
+		}
+	}
+}
+
+// infer returns the most specific type matched by at least threshold (0-1)
+// of the non-empty values, with that share; name is the column's name
+func (t *typeTally) infer(threshold float64, name string) (valueType, float64) {
+	if t.nonEmpty == 0 {
+		return typeText, 0
+	}
+	for _, vt := range inferOrder {
+		if vt == typeInteger {
+			for _, s := range exactShapes {
+				if t.matches[s] == t.nonEmpty && (t.formatted[s] > 0 || nameSuggests(s, name)) {
+					return s, 1
+				}
+			}
+		}
+		share := float64(t.matches[vt]) / float64(t.nonEmpty)
+		if share >= threshold {
+			return vt, share
+		}
+	}
+	return typeText, 1
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// formatShare renders a 0-1 share as a percentage
+func formatShare(f float64) string {
+	return strconv.FormatFloat(f*100, 'f', 1, 64) + "%"
+}
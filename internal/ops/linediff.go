@@ -0,0 +1,352 @@
+package ops
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// DiffOpts configures how text members are diffed in previews
+// MaxHunks of 0 prints every hunk
+type DiffOpts struct {
+	Context     int
+	MaxHunks    int
+	IgnoreSpace bool
+	IgnoreEOL   bool
+	Color       bool
+}
+
+// ANSI escapes used when DiffOpts.Color is set
+const (
+	ansiReset = "\x1b[0m"
+	ansiRed   = "\x1b[31m"
+	ansiGreen = "\x1b[32m"
+	ansiCyan  = "\x1b[36m"
+	ansiBold  = "\x1b[1m"
+)
+
+// maxDiffLineWidth caps how much of a single line is echoed in a preview
+const maxDiffLineWidth = 120
+
+type diffLine struct {
+	kind byte // ' ', '-' or '+'
+	text string
+}
+
+type diffHunk struct {
+	aStart, aLen int
+	bStart, bLen int
+	lines        []diffLine
+}
+
+// splitLines splits content on "\n", dropping the empty element left by a
+// trailing newline
+func splitLines(content []byte) []string {
+	if len(content) == 0 {
+		return nil
+	}
+	lines := strings.Split(string(content), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// lineDiff computes a unified diff of a against b using Myers' linear-space
+// algorithm, grouping changes into hunks with o.Context lines of context
+func lineDiff(a, b []string, o DiffOpts) []diffHunk {
+	ids := map[string]int{}
+	intern := func(lines []string) []int {
+		out := make([]int, len(lines))
+		for i, l := range lines {
+			k := normalizeDiffLine(l, o)
+			id, ok := ids[k]
+			if !ok {
+				id = len(ids)
+				ids[k] = id
+			}
+			out[i] = id
+		}
+		return out
+	}
+
+	m := &myers{
+		a:    intern(a),
+		b:    intern(b),
+		delA: make([]bool, len(a)),
+		insB: make([]bool, len(b)),
+	}
+	m.compare(0, len(a), 0, len(b))
+
+	return buildHunks(a, b, m.delA, m.insB, max(o.Context, 0))
+}
+
+func normalizeDiffLine(l string, o DiffOpts) string {
+	if o.IgnoreEOL {
+		l = strings.TrimSuffix(l, "\r")
+	}
+	if o.IgnoreSpace {
+		l = strings.Map(func(r rune) rune {
+			if unicode.IsSpace(r) {
+				return -1
+			}
+			return r
+		}, l)
+	}
+	return l
+}
+
+// myers marks lines of a deleted and lines of b inserted on a shortest edit
+// script, splitting the problem at the middle snake so space stays linear
+type myers struct {
+	a, b       []int
+	delA, insB []bool
+}
+
+func (m *myers) compare(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && m.a[aLo] == m.b[bLo] {
+		aLo++
+		bLo++
+	}
+	for aLo < aHi && bLo < bHi && m.a[aHi-1] == m.b[bHi-1] {
+		aHi--
+		bHi--
+	}
+
+	if aLo == aHi {
+		for j := bLo; j < bHi; j++ {
+			m.insB[j] = true
+		}
+		return
+	}
+	if bLo == bHi {
+		for i := aLo; i < aHi; i++ {
+			m.delA[i] = true
+		}
+		return
+	}
+
+	x, y, ok := m.bisect(aLo, aHi, bLo, bHi)
+	if !ok {
+		for i := aLo; i < aHi; i++ {
+			m.delA[i] = true
+		}
+		for j := bLo; j < bHi; j++ {
+			m.insB[j] = true
+		}
+		return
+	}
+
+	m.compare(aLo, x, bLo, y)
+	m.compare(x, aHi, y, bHi)
+}
+
+// bisect finds the point where the forward and reverse searches overlap,
+// returning it in absolute coordinates
+func (m *myers) bisect(aLo, aHi, bLo, bHi int) (int, int, bool) {
+	n, mm := aHi-aLo, bHi-bLo
+	maxD := (n + mm + 1) / 2
+	off := maxD
+	size := 2*maxD + 2
+	v1 := make([]int, size)
+	v2 := make([]int, size)
+	for i := range v1 {
+		v1[i] = -1
+		v2[i] = -1
+	}
+	v1[off+1] = 0
+	v2[off+1] = 0
+
+	delta := n - mm
+	front := delta%2 != 0
+	k1start, k1end, k2start, k2end := 0, 0, 0, 0
+
+	for d := range maxD {
+		for k1 := -d + k1start; k1 <= d-k1end; k1 += 2 {
+			k1off := off + k1
+			var x1 int
+			if k1 == -d || (k1 != d && v1[k1off-1] < v1[k1off+1]) {
+				x1 = v1[k1off+1]
+			} else {
+				x1 = v1[k1off-1] + 1
+			}
+			y1 := x1 - k1
+			for x1 < n && y1 < mm && m.a[aLo+x1] == m.b[bLo+y1] {
+				x1++
+				y1++
+			}
+			v1[k1off] = x1
+			if x1 > n {
+				k1end += 2
+			} else if y1 > mm {
+				k1start += 2
+			} else if front {
+				k2off := off + delta - k1
+				if k2off >= 0 && k2off < size && v2[k2off] != -1 {
+					if x1 >= n-v2[k2off] {
+						return aLo + x1, bLo + y1, true
+					}
+				}
+			}
+		}
+
+		for k2 := -d + k2start; k2 <= d-k2end; k2 += 2 {
+			k2off := off + k2
+			var x2 int
+			if k2 == -d || (k2 != d && v2[k2off-1] < v2[k2off+1]) {
+				x2 = v2[k2off+1]
+			} else {
+				x2 = v2[k2off-1] + 1
+			}
+			y2 := x2 - k2
+			for x2 < n && y2 < mm && m.a[aHi-x2-1] == m.b[bHi-y2-1] {
+				x2++
+				y2++
+			}
+			v2[k2off] = x2
+			if x2 > n {
+				k2end += 2
+			} else if y2 > mm {
+				k2start += 2
+			} else if !front {
+				k1off := off + delta - k2
+				if k1off >= 0 && k1off < size && v1[k1off] != -1 {
+					x1 := v1[k1off]
+					y1 := off + x1 - k1off
+					if x1 >= n-x2 {
+						return aLo + x1, bLo + y1, true
+					}
+				}
+			}
+		}
+	}
+
+	return 0, 0, false
+}
+
+type editOp struct {
+	kind byte
+	ai   int // index into a before this op
+	bj   int // index into b before this op
+}
+
+func buildHunks(a, b []string, delA, insB []bool, context int) []diffHunk {
+	var ops []editOp
+	var changes []int
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && delA[i]:
+			changes = append(changes, len(ops))
+			ops = append(ops, editOp{'-', i, j})
+			i++
+		case j < len(b) && insB[j]:
+			changes = append(changes, len(ops))
+			ops = append(ops, editOp{'+', i, j})
+			j++
+		default:
+			ops = append(ops, editOp{' ', i, j})
+			i++
+			j++
+		}
+	}
+
+	var hunks []diffHunk
+	for c := 0; c < len(changes); {
+		start := max(changes[c]-context, 0)
+		last := changes[c]
+		c++
+		for c < len(changes) && changes[c]-last <= 2*context+1 {
+			last = changes[c]
+			c++
+		}
+		end := min(last+context+1, len(ops))
+
+		h := diffHunk{aStart: ops[start].ai, bStart: ops[start].bj}
+		for _, op := range ops[start:end] {
+			switch op.kind {
+			case ' ':
+				h.lines = append(h.lines, diffLine{' ', a[op.ai]})
+				h.aLen++
+				h.bLen++
+			case '-':
+				h.lines = append(h.lines, diffLine{'-', a[op.ai]})
+				h.aLen++
+			case '+':
+				h.lines = append(h.lines, diffLine{'+', b[op.bj]})
+				h.bLen++
+			}
+		}
+		hunks = append(hunks, h)
+	}
+
+	return hunks
+}
+
+// writeUnified prints hunks in unified diff format, indented to match the
+// rest of the comparison output
+func writeUnified(w io.Writer, nameA, nameB string, hunks []diffHunk, o DiffOpts) {
+	paint := func(color, s string) string {
+		if !o.Color {
+			return s
+		}
+		return color + s + ansiReset
+	}
+
+	fmt.Fprintf(w, "  %s\n", paint(ansiBold, "--- A/"+nameA))
+	fmt.Fprintf(w, "  %s\n", paint(ansiBold, "+++ B/"+nameB))
+
+	for n, h := range hunks {
+		if o.MaxHunks > 0 && n >= o.MaxHunks {
+			fmt.Fprintf(w, "  ... (%d more hunks)\n", len(hunks)-n)
+			break
+		}
+		header := fmt.Sprintf("@@ -%s +%s @@", unifiedRange(h.aStart, h.aLen), unifiedRange(h.bStart, h.bLen))
+		fmt.Fprintf(w, "  %s\n", paint(ansiCyan, header))
+		markCR := mixedLineEndings(h.lines)
+		for _, l := range h.lines {
+			body, cr := strings.CutSuffix(l.text, "\r")
+			text := string(l.kind) + truncateLine(body, maxDiffLineWidth)
+			if cr && markCR && l.kind != ' ' {
+				text += "␍"
+			}
+			switch l.kind {
+			case '-':
+				text = paint(ansiRed, text)
+			case '+':
+				text = paint(ansiGreen, text)
+			}
+			fmt.Fprintf(w, "  %s\n", text)
+		}
+	}
+}
+
+// mixedLineEndings reports whether some changed lines of a hunk end in \r
+// and others do not, in which case the \r is shown as ␍ so a line-ending-only
+// change stays visible
+func mixedLineEndings(lines []diffLine) bool {
+	var withCR, withoutCR bool
+	for _, l := range lines {
+		if l.kind == ' ' {
+			continue
+		}
+		if strings.HasSuffix(l.text, "\r") {
+			withCR = true
+		} else {
+			withoutCR = true
+		}
+	}
+	return withCR && withoutCR
+}
+
+func unifiedRange(start, n int) string {
+	switch n {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	default:
+		return fmt.Sprintf("%d,%d", start+1, n)
+	}
+}
@@ -2,18 +2,27 @@ package ops
 
 import (
 	"fmt"
-	"io"
 	"os"
+	"slices"
 	"sort"
 	"strings"
+	"text/tabwriter"
 
 	"github.com/c-a-ray/dkit/internal/core"
 )
 
+// ListColsOpts configures column listing
+// PerFile prints each file's header with positions; Common keeps only
+// columns found in every file and Diff only those missing from some file;
+// Counts adds how many files contain each column
 type ListColsOpts struct {
 	Sorted       bool
 	OneLine      bool
 	OneLineDelim string
+	PerFile      bool
+	Common       bool
+	Diff         bool
+	Counts       bool
 	Config       *core.Config
 }
 
@@ -23,35 +32,34 @@ func ListColumns(files []string, o ListColsOpts) error {
 		return fmt.Errorf("no files")
 	}
 
-	seen := map[string]struct{}{}
-	var out []string
-
-	for _, path := range files {
-		rc, err := core.OpenWithEncoding(path, o.Config.Encoding)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "[WARN] cannot read %s: %v\n", path, err)
-			continue
-		}
-		cr := core.NewCSVReader(rc, o.Config.Delim, o.Config.LazyQuotes)
+	headers := readHeaders(files, o.Config)
 
-		hdr, err := cr.Read()
-		if err == io.EOF {
-			fmt.Fprintf(os.Stderr, "[WARN] %s is empty\n", path)
-			rc.Close()
-			continue
-		} else if err != nil {
-			fmt.Fprintf(os.Stderr, "[WARN] %s: %v\n", path, err)
-			rc.Close()
-			continue
-		}
+	if o.PerFile {
+		printPerFileColumns(headers, o)
+		return nil
+	}
 
-		for _, h := range hdr {
-			if _, ok := seen[h]; !ok {
-				seen[h] = struct{}{}
+	counts := map[string]int{}
+	var out []string
+	for _, fh := range headers {
+		seen := map[string]bool{}
+		for _, h := range fh.header {
+			if seen[h] {
+				continue
+			}
+			seen[h] = true
+			if counts[h] == 0 {
 				out = append(out, h)
 			}
+			counts[h]++
 		}
-		rc.Close()
+	}
+
+	switch {
+	case o.Common:
+		out = slices.DeleteFunc(out, func(c string) bool { return counts[c] < len(headers) })
+	case o.Diff:
+		out = slices.DeleteFunc(out, func(c string) bool { return counts[c] == len(headers) })
 	}
 
 	if o.Sorted {
@@ -59,7 +67,18 @@ func ListColumns(files []string, o ListColsOpts) error {
 	}
 
 	if o.OneLine {
+		if o.Counts {
+			for i, c := range out {
+				out[i] = fmt.Sprintf("%s (%d/%d)", c, counts[c], len(headers))
+			}
+		}
 		fmt.Println(strings.Join(out, o.OneLineDelim))
+	} else if o.Counts {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, c := range out {
+			fmt.Fprintf(w, "%s\t%d/%d\n", c, counts[c], len(headers))
+		}
+		w.Flush()
 	} else {
 		for _, c := range out {
 			fmt.Println(c)
@@ -68,3 +87,23 @@ func ListColumns(files []string, o ListColsOpts) error {
 
 	return nil
 }
+
+// printPerFileColumns prints each file's header with 0-based positions, as
+// used for column indexes with --no-header
+func printPerFileColumns(headers []fileHeader, o ListColsOpts) {
+	for i, fh := range headers {
+		if o.OneLine {
+			fmt.Printf("%s: %s\n", fh.path, strings.Join(fh.header, o.OneLineDelim))
+			continue
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s (%d columns)\n", fh.path, len(fh.header))
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for pos, h := range fh.header {
+			fmt.Fprintf(w, "  %d\t%s\n", pos, h)
+		}
+		w.Flush()
+	}
+}
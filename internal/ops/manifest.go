@@ -0,0 +1,333 @@
+package ops
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/c-a-ray/dkit/internal/core"
+)
+
+// Manifest records the members of a delivery so later drops can be verified
+// against it without keeping the original archive
+type Manifest struct {
+	Source  string          `json:"source"`
+	Created time.Time       `json:"created"`
+	Files   []ManifestEntry `json:"files"`
+}
+
+// ManifestEntry describes one member; Rows and Header are only recorded for
+// tabular members (.csv, .tsv, .psv, .txt)
+type ManifestEntry struct {
+	Path   string   `json:"path"`
+	Size   uint64   `json:"size"`
+	SHA256 string   `json:"sha256"`
+	Rows   *int64   `json:"rows,omitempty"`
+	Header []string `json:"header,omitempty"`
+}
+
+// ManifestOpts configures manifest creation and verification
+// Path is a ZIP, tar archive, or directory, as accepted by CompareArchives
+type ManifestOpts struct {
+	Path      string
+	Output    string
+	Recursive bool
+	MaxDepth  int
+	Quiet     bool
+	Config    *core.Config
+}
+
+// ManifestVerifyResult summarizes a verification run
+type ManifestVerifyResult struct {
+	Matched int
+	Changed int
+	Missing int
+	Extra   int
+	// Unreadable counts listed members that exist but could not be hashed
+	Unreadable int
+}
+
+// CreateManifest writes a JSON manifest of o.Path to o.Output, or stdout
+func CreateManifest(o ManifestOpts) (Manifest, error) {
+	arch, err := openArchive(o.Path, readAgain{text: true, nested: o.Recursive})
+	if err != nil {
+		return Manifest{}, fmt.Errorf("failed to open %s: %w", o.Path, err)
+	}
+	defer arch.Close()
+
+	if o.Recursive {
+		arch.expandNestedZips(o.MaxDepth)
+	}
+
+	m := Manifest{
+		Source:  filepath.Base(o.Path),
+		Created: time.Now().UTC().Truncate(time.Second),
+	}
+
+	names := make([]string, 0, len(arch.members))
+	for name := range arch.members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// An unreadable member would later look like an unexpected extra, so
+	// refuse to write a manifest that leaves any out
+	unreadable := 0
+	for _, name := range names {
+		e, err := manifestEntry(arch.members[name], o.Config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[WARN] cannot read %s: %v\n", name, err)
+			unreadable++
+			continue
+		}
+		m.Files = append(m.Files, e)
+	}
+	if unreadable > 0 {
+		return m, fmt.Errorf("%d member(s) of %s could not be read; manifest not written", unreadable, o.Path)
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return m, err
+	}
+	data = append(data, '\n')
+
+	if o.Output == "" {
+		_, err = os.Stdout.Write(data)
+		return m, err
+	}
+	if err := os.WriteFile(o.Output, data, 0o644); err != nil {
+		return m, err
+	}
+	if !o.Quiet {
+		fmt.Fprintf(os.Stderr, "Wrote manifest of %d files to %s\n", len(m.Files), o.Output)
+	}
+	return m, nil
+}
+
+// VerifyManifest checks o.Path against the manifest at manifestPath,
+// reporting changed, missing, and unexpected members
+func VerifyManifest(manifestPath string, o ManifestOpts) (ManifestVerifyResult, error) {
+	res := ManifestVerifyResult{}
+
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return res, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return res, fmt.Errorf("invalid manifest %s: %w", manifestPath, err)
+	}
+
+	arch, err := openArchive(o.Path, readAgain{text: true, nested: o.Recursive})
+	if err != nil {
+		return res, fmt.Errorf("failed to open %s: %w", o.Path, err)
+	}
+	defer arch.Close()
+
+	if o.Recursive {
+		arch.expandNestedZips(o.MaxDepth)
+	}
+
+	if !o.Quiet {
+		fmt.Fprintf(os.Stderr, "\n")
+		fmt.Fprintf(os.Stderr, "═══════════════════════════════════════════════════════════\n")
+		fmt.Fprintf(os.Stderr, "Verifying %s against manifest\n", arch.kind)
+		fmt.Fprintf(os.Stderr, "═══════════════════════════════════════════════════════════\n")
+		fmt.Fprintf(os.Stderr, "\nManifest: %s (%s, %s)\n", filepath.Base(manifestPath), m.Source, m.Created.Format(time.DateTime))
+		fmt.Fprintf(os.Stderr, "Archive:  %s\n\n", filepath.Base(o.Path))
+	}
+
+	listed := make(map[string]bool, len(m.Files))
+	for _, want := range m.Files {
+		listed[want.Path] = true
+
+		mem := arch.members[want.Path]
+		if mem == nil {
+			res.Missing++
+			if !o.Quiet {
+				fmt.Printf("✗ %s (missing)\n", want.Path)
+			}
+			continue
+		}
+
+		got, err := manifestEntry(mem, o.Config)
+		if err != nil {
+			res.Unreadable++
+			if !o.Quiet {
+				fmt.Printf("✗ %s (unreadable: %v)\n", want.Path, err)
+			}
+			continue
+		}
+
+		diffs := manifestDiffs(want, got)
+		if len(diffs) == 0 {
+			res.Matched++
+			if !o.Quiet {
+				fmt.Printf("✅ %s (matches)\n", want.Path)
+			}
+			continue
+		}
+
+		res.Changed++
+		if !o.Quiet {
+			fmt.Printf("⚠ %s (changed)\n", want.Path)
+			for _, d := range diffs {
+				fmt.Printf("    ↳ %s\n", d)
+			}
+		}
+	}
+
+	var extra []string
+	for name := range arch.members {
+		if !listed[name] {
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(extra)
+	for _, name := range extra {
+		res.Extra++
+		if !o.Quiet {
+			fmt.Printf("→ %s (not in manifest)\n", name)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "\n")
+	fmt.Fprintf(os.Stderr, "═══════════════════════════════════════════════════════════\n")
+	fmt.Fprintf(os.Stderr, "Summary\n")
+	fmt.Fprintf(os.Stderr, "═══════════════════════════════════════════════════════════\n")
+	fmt.Fprintf(os.Stderr, "\n")
+	fmt.Fprintf(os.Stderr, "Matching files:   %d\n", res.Matched)
+	fmt.Fprintf(os.Stderr, "Changed files:    %d\n", res.Changed)
+	fmt.Fprintf(os.Stderr, "Missing files:    %d\n", res.Missing)
+	if res.Unreadable > 0 {
+		fmt.Fprintf(os.Stderr, "Unreadable files: %d\n", res.Unreadable)
+	}
+	fmt.Fprintf(os.Stderr, "Not in manifest:  %d\n", res.Extra)
+	fmt.Fprintf(os.Stderr, "\n")
+
+	return res, nil
+}
+
+// manifestEntry hashes a member and, for tabular members, counts rows and
+// captures the header in the same pass
+func manifestEntry(mem *archiveMember, cfg *core.Config) (ManifestEntry, error) {
+	e := ManifestEntry{Path: mem.name, Size: mem.size}
+
+	rc, err := mem.open()
+	if err != nil {
+		return e, err
+	}
+	defer rc.Close()
+
+	h := sha256.New()
+	tee := io.TeeReader(rc, h)
+
+	if delim, ok := tabularDelim(mem.name, cfg.Delim); ok {
+		rows, header, err := countRows(core.DecodeReader(tee, cfg.Encoding), delim, cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[WARN] %s: %v (row count skipped)\n", mem.name, err)
+		} else {
+			e.Rows = &rows
+			e.Header = header
+		}
+	}
+
+	// Drain whatever the CSV reader left so the digest covers the whole member
+	if _, err := io.Copy(io.Discard, tee); err != nil {
+		return e, err
+	}
+	e.SHA256 = hex.EncodeToString(h.Sum(nil))
+	return e, nil
+}
+
+// tabularDelim picks the delimiter for a member by extension, reporting false
+// for members that are not treated as tabular
+func tabularDelim(name string, fallback rune) (rune, bool) {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".tsv":
+		return '\t', true
+	case ".psv":
+		return '|', true
+	case ".csv", ".txt":
+		return fallback, true
+	default:
+		return 0, false
+	}
+}
+
+func countRows(r io.Reader, delim rune, cfg *core.Config) (int64, []string, error) {
+	cr := core.NewCSVReader(r, delim, cfg.LazyQuotes)
+	cr.FieldsPerRecord = -1
+
+	var header []string
+	if !cfg.NoHeader {
+		hdr, err := cr.Read()
+		if err == io.EOF {
+			return 0, nil, nil
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		header = slices.Clone(hdr)
+	}
+
+	var rows int64
+	for {
+		_, err := cr.Read()
+		if err == io.EOF {
+			return rows, header, nil
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		rows++
+	}
+}
+
+func manifestDiffs(want, got ManifestEntry) []string {
+	var out []string
+	if want.Size != got.Size {
+		out = append(out, fmt.Sprintf("size: manifest=%d, now=%d", want.Size, got.Size))
+	}
+	if want.SHA256 != got.SHA256 {
+		out = append(out, fmt.Sprintf("sha256: manifest=%s, now=%s", shortHash(want.SHA256), shortHash(got.SHA256)))
+	}
+	if want.Rows != nil && got.Rows != nil && *want.Rows != *got.Rows {
+		out = append(out, fmt.Sprintf("rows: manifest=%d, now=%d", *want.Rows, *got.Rows))
+	}
+	if want.Header != nil && got.Header != nil && !slices.Equal(want.Header, got.Header) {
+		out = append(out, fmt.Sprintf("header: manifest=%s, now=%s", quoteList(want.Header), quoteList(got.Header)))
+	}
+	return out
+}
+
+func shortHash(h string) string {
+	if len(h) > 12 {
+		return h[:12]
+	}
+	return h
+}
+
+func quoteList(vals []string) string {
+	var b bytes.Buffer
+	b.WriteByte('[')
+	for i, v := range vals {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "%q", v)
+	}
+	b.WriteByte(']')
+	return b.String()
+}
@@ -0,0 +1,82 @@
+package ops
+
+import (
+	"archive/zip"
+	"fmt"
+	"io/fs"
+	"time"
+)
+
+// memberMeta holds the metadata an archive records for a member
+// method and comment only exist in ZIP archives (hasZipMeta); wallClock
+// marks a modification time with no time zone, and hasMode permission bits
+// the source actually recorded
+type memberMeta struct {
+	modified   time.Time
+	wallClock  bool
+	mode       fs.FileMode
+	hasMode    bool
+	method     string
+	comment    string
+	hasZipMeta bool
+}
+
+// zipCreatorUnix is the "version made by" host of ZIPs written on Unix
+const zipCreatorUnix = 3
+
+// mtimeTolerance absorbs the 2-second resolution of ZIP (MS-DOS) timestamps
+const mtimeTolerance = 2 * time.Second
+
+// metaDiffs lists the metadata fields that differ between two members,
+// comparing only fields both sources record
+func metaDiffs(a, b memberMeta) []string {
+	var out []string
+
+	if !a.modified.IsZero() && !b.modified.IsZero() {
+		ta, tb := a.modified, b.modified
+		// A time without a zone can only be compared as local wall-clock time
+		if a.wallClock || b.wallClock {
+			ta, tb = wallClockTime(a), wallClockTime(b)
+		}
+		if d := ta.Sub(tb); d >= mtimeTolerance || d <= -mtimeTolerance {
+			out = append(out, fmt.Sprintf("modified: A=%s, B=%s",
+				ta.Format(time.DateTime), tb.Format(time.DateTime)))
+		}
+	}
+
+	if a.hasMode && b.hasMode && a.mode.Perm() != b.mode.Perm() {
+		out = append(out, fmt.Sprintf("permissions: A=%s, B=%s", a.mode.Perm(), b.mode.Perm()))
+	}
+
+	if a.hasZipMeta && b.hasZipMeta {
+		if a.method != b.method {
+			out = append(out, fmt.Sprintf("compression: A=%s, B=%s", a.method, b.method))
+		}
+		if a.comment != b.comment {
+			out = append(out, fmt.Sprintf("comment: A=%q, B=%q", a.comment, b.comment))
+		}
+	}
+
+	return out
+}
+
+// wallClockTime returns a member's modification time as local wall-clock
+// time, expressed in UTC so zoneless and zoned times compare directly
+func wallClockTime(m memberMeta) time.Time {
+	t := m.modified
+	if !m.wallClock {
+		t = t.In(time.Local)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+func zipMethodName(m uint16) string {
+	switch m {
+	case zip.Store:
+		return "store"
+	case zip.Deflate:
+		return "deflate"
+	default:
+		return fmt.Sprintf("method %d", m)
+	}
+}
@@ -0,0 +1,188 @@
+package ops
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// PathMapOpts selects archive members and maps their names to the keys used
+// to pair members across archives
+// Include/Exclude are globs ("*" within a path segment, "**" across
+// segments); a pattern without "/" matches the base name only
+// StripComponents drops leading path segments, as tar does
+// Rewrites are "REGEX=>REPLACEMENT" rules applied in order after stripping
+type PathMapOpts struct {
+	Include         []string
+	Exclude         []string
+	StripComponents int
+	Rewrites        []string
+	IgnoreCase      bool
+}
+
+type pathRewrite struct {
+	re   *regexp.Regexp
+	repl string
+}
+
+// pathMapper is a compiled PathMapOpts
+type pathMapper struct {
+	include    []glob
+	exclude    []glob
+	strip      int
+	rewrites   []pathRewrite
+	ignoreCase bool
+}
+
+func (o PathMapOpts) compile() (*pathMapper, error) {
+	pm := &pathMapper{strip: o.StripComponents, ignoreCase: o.IgnoreCase}
+	if pm.strip < 0 {
+		return nil, fmt.Errorf("--strip-components must not be negative")
+	}
+
+	for _, g := range o.Include {
+		gl, err := compileGlob(g)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --include %q: %w", g, err)
+		}
+		pm.include = append(pm.include, gl)
+	}
+	for _, g := range o.Exclude {
+		gl, err := compileGlob(g)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --exclude %q: %w", g, err)
+		}
+		pm.exclude = append(pm.exclude, gl)
+	}
+
+	for _, r := range o.Rewrites {
+		from, to, ok := strings.Cut(r, "=>")
+		if !ok {
+			return nil, fmt.Errorf("invalid --rewrite %q (expected REGEX=>REPLACEMENT)", r)
+		}
+		re, err := regexp.Compile(from)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --rewrite %q: %w", r, err)
+		}
+		pm.rewrites = append(pm.rewrites, pathRewrite{re: re, repl: to})
+	}
+
+	return pm, nil
+}
+
+// key maps a member name to its pairing key, reporting false when the member
+// is filtered out or has too few path segments to strip
+func (pm *pathMapper) key(name string) (string, bool) {
+	if len(pm.include) > 0 && !matchAnyGlob(pm.include, name) {
+		return "", false
+	}
+	if matchAnyGlob(pm.exclude, name) {
+		return "", false
+	}
+
+	k := name
+	if pm.strip > 0 {
+		parts := strings.Split(k, "/")
+		if len(parts) <= pm.strip {
+			return "", false
+		}
+		k = strings.Join(parts[pm.strip:], "/")
+	}
+	for _, rw := range pm.rewrites {
+		k = rw.re.ReplaceAllString(k, rw.repl)
+	}
+	if pm.ignoreCase {
+		k = strings.ToLower(k)
+	}
+	return k, k != ""
+}
+
+// apply keys an archive's members, warning when two members collide on the
+// same key; the first in name order wins
+func (pm *pathMapper) apply(members map[string]*archiveMember, side string) map[string]*archiveMember {
+	names := make([]string, 0, len(members))
+	for name := range members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := make(map[string]*archiveMember, len(members))
+	for _, name := range names {
+		k, ok := pm.key(name)
+		if !ok {
+			continue
+		}
+		if prev, dup := out[k]; dup {
+			fmt.Fprintf(os.Stderr, "[WARN] archive %s: %s and %s both map to %s; ignoring %s\n", side, prev.name, name, k, name)
+			continue
+		}
+		out[k] = members[name]
+	}
+	return out
+}
+
+// glob is a compiled glob; base globs have no "/" and match base names
+type glob struct {
+	re   *regexp.Regexp
+	base bool
+}
+
+func (g glob) match(name string) bool {
+	if g.base {
+		name = path.Base(name)
+	}
+	return g.re.MatchString(name)
+}
+
+func matchAnyGlob(globs []glob, name string) bool {
+	for _, g := range globs {
+		if g.match(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// compileGlob turns a glob into an anchored regexp
+func compileGlob(g string) (glob, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(g); i++ {
+		c := g[i]
+		switch {
+		case strings.HasPrefix(g[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(g[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			j := strings.IndexByte(g[i:], ']')
+			if j < 0 {
+				return glob{}, fmt.Errorf("unterminated character class")
+			}
+			class := g[i+1 : i+j]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += j
+		default:
+			b.WriteString(regexp.QuoteMeta(g[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return glob{}, err
+	}
+	return glob{re: re, base: !strings.Contains(g, "/")}, nil
+}
@@ -0,0 +1,248 @@
+package ops
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/c-a-ray/dkit/internal/core"
+)
+
+// ProfileOpts configures column profiling
+// ExactDistinct is how many distinct values per column are counted exactly
+// before switching to HyperLogLog and approximate top values
+// TypeThreshold is the share (0-1) of non-empty values that must match a
+// type for it to be inferred; the rest are reported as anomalies
+type ProfileOpts struct {
+	Top           int
+	ExactDistinct int
+	TypeThreshold float64
+	JSON          bool
+	Config        *core.Config
+}
+
+// ColumnProfile summarizes one column across all profiled files
+type ColumnProfile struct {
+	Name           string      `json:"name"`
+	Files          int         `json:"files"`
+	Type           string      `json:"type"`
+	TypeShare      float64     `json:"type_share"`
+	Rows           int64       `json:"rows"`
+	Nulls          int64       `json:"nulls"`
+	NullRate       float64     `json:"null_rate"`
+	Distinct       uint64      `json:"distinct"`
+	DistinctApprox bool        `json:"distinct_approx,omitempty"`
+	MinLength      int         `json:"min_length"`
+	MaxLength      int         `json:"max_length"`
+	TopValues      []ValueFreq `json:"top_values"`
+	Anomalies      []string    `json:"anomalies,omitempty"`
+}
+
+// ValueFreq is a value with its count
+type ValueFreq struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// columnAcc accumulates a column profile in a single pass
+type columnAcc struct {
+	name     string
+	files    int
+	rows     int64
+	nulls    int64
+	minLen   int
+	maxLen   int
+	types    typeTally
+	distinct *distinctCounter
+}
+
+func (c *columnAcc) add(v string) {
+	c.rows++
+	if v == "" {
+		c.nulls++
+		return
+	}
+	n := utf8.RuneCountInString(v)
+	if c.types.nonEmpty == 0 || n < c.minLen {
+		c.minLen = n
+	}
+	if n > c.maxLen {
+		c.maxLen = n
+	}
+	c.types.add(v)
+	c.distinct.add(v)
+}
+
+func (c *columnAcc) profile(o ProfileOpts) ColumnProfile {
+	vt, share := c.types.infer(o.TypeThreshold, c.name)
+	p := ColumnProfile{
+		Name:           c.name,
+		Files:          c.files,
+		Type:           vt.String(),
+		TypeShare:      share,
+		Rows:           c.rows,
+		Nulls:          c.nulls,
+		Distinct:       c.distinct.distinct(),
+		DistinctApprox: c.distinct.approximate(),
+		MinLength:      c.minLen,
+		MaxLength:      c.maxLen,
+		Anomalies:      c.types.mismatches[vt],
+	}
+	if c.types.nonEmpty == 0 {
+		p.Type = "empty"
+	}
+	if c.rows > 0 {
+		p.NullRate = float64(c.nulls) / float64(c.rows)
+	}
+	for _, vc := range c.distinct.top(o.Top) {
+		p.TopValues = append(p.TopValues, ValueFreq{Value: vc.value, Count: vc.count})
+	}
+	return p
+}
+
+// ProfileColumns scans files once and profiles every column, matching
+// columns across files by header name (or index with --no-header)
+func ProfileColumns(files []string, o ProfileOpts) ([]ColumnProfile, error) {
+	if len(files) == 0 {
+		return nil, errors.New("no files")
+	}
+
+	accs := map[string]*columnAcc{}
+	var order []string
+	column := func(name string) *columnAcc {
+		c := accs[name]
+		if c == nil {
+			c = &columnAcc{name: name, distinct: newDistinctCounter(o.ExactDistinct, max(o.Top*10, 100))}
+			accs[name] = c
+			order = append(order, name)
+		}
+		return c
+	}
+
+	for _, path := range files {
+		rc, err := core.OpenWithEncoding(path, o.Config.Encoding)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[WARN] cannot read %s: %v\n", path, err)
+			continue
+		}
+		cr := core.NewCSVReader(rc, o.Config.Delim, o.Config.LazyQuotes)
+		cr.FieldsPerRecord = -1
+
+		var cols []*columnAcc
+		if !o.Config.NoHeader {
+			hdr, err := cr.Read()
+			if err == io.EOF {
+				fmt.Fprintf(os.Stderr, "[WARN] %s is empty\n", path)
+				rc.Close()
+				continue
+			} else if err != nil {
+				fmt.Fprintf(os.Stderr, "[WARN] %s: %v\n", path, err)
+				rc.Close()
+				continue
+			}
+			for _, h := range hdr {
+				c := column(h)
+				c.files++
+				cols = append(cols, c)
+			}
+		}
+
+		for {
+			rec, err := cr.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "[WARN] %s: %v\n", path, err)
+				break
+			}
+			// Without a header, columns are discovered as rows widen
+			for len(cols) < len(rec) && o.Config.NoHeader {
+				c := column(strconv.Itoa(len(cols)))
+				c.files++
+				cols = append(cols, c)
+			}
+			for i, c := range cols {
+				var v string
+				if i < len(rec) {
+					v = strings.TrimSpace(rec[i])
+				}
+				c.add(v)
+			}
+		}
+		rc.Close()
+	}
+
+	out := make([]ColumnProfile, 0, len(order))
+	for _, name := range order {
+		out = append(out, accs[name].profile(o))
+	}
+	return out, nil
+}
+
+// Profile prints a profile of every column in text or JSON form
+func Profile(files []string, o ProfileOpts) error {
+	profiles, err := ProfileColumns(files, o)
+	if err != nil {
+		return err
+	}
+
+	if o.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(profiles)
+	}
+
+	for i, p := range profiles {
+		if i > 0 {
+			fmt.Println()
+		}
+		printColumnProfile(p)
+	}
+	return nil
+}
+
+func printColumnProfile(p ColumnProfile) {
+	fmt.Printf("Column: %s\n", p.Name)
+	if p.Type == "empty" {
+		fmt.Printf("  type:       empty\n")
+	} else {
+		fmt.Printf("  type:       %s (%s of non-empty)\n", p.Type, formatShare(p.TypeShare))
+	}
+	fmt.Printf("  nulls:      %d / %d (%s)\n", p.Nulls, p.Rows, formatShare(p.NullRate))
+
+	approx := ""
+	if p.DistinctApprox {
+		approx = " (approx)"
+	}
+	fmt.Printf("  distinct:   %d%s\n", p.Distinct, approx)
+
+	if p.Type != "empty" {
+		fmt.Printf("  length:     %d..%d\n", p.MinLength, p.MaxLength)
+	}
+
+	if len(p.TopValues) > 0 {
+		parts := make([]string, len(p.TopValues))
+		for i, vf := range p.TopValues {
+			parts[i] = fmt.Sprintf("%s (%d)", truncateLine(vf.Value, 40), vf.Count)
+		}
+		label := "top:"
+		if p.DistinctApprox {
+			label = "top (approx):"
+		}
+		fmt.Printf("  %-11s %s\n", label, strings.Join(parts, ", "))
+	}
+
+	if len(p.Anomalies) > 0 && p.Type != "text" {
+		parts := make([]string, len(p.Anomalies))
+		for i, a := range p.Anomalies {
+			parts[i] = strconv.Quote(truncateLine(a, 40))
+		}
+		fmt.Printf("  anomalies:  %s\n", strings.Join(parts, ", "))
+	}
+}
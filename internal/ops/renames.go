@@ -0,0 +1,164 @@
+package ops
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path"
+	"sort"
+)
+
+// renamePair is a member only in A matched to a member only in B
+// similarity is 1 for exact content matches
+type renamePair struct {
+	keyA, keyB string
+	similarity float64
+	exact      bool
+}
+
+// kind reports "moved" when only the directory changed, else "renamed"
+func (p renamePair) kind(memA, memB *archiveMember) string {
+	if path.Base(memA.name) == path.Base(memB.name) {
+		return "moved"
+	}
+	return "renamed"
+}
+
+// findRenames pairs members only in A with members only in B, first by
+// identical content (size and SHA-256), then for text members by line
+// similarity of at least threshold; paired keys are removed from onlyA and
+// onlyB
+func findRenames(filesA, filesB map[string]*archiveMember, onlyA, onlyB []string, threshold float64, diff DiffOpts) ([]renamePair, []string, []string) {
+	var pairs []renamePair
+	usedA := map[string]bool{}
+	usedB := map[string]bool{}
+
+	// Exact matches: only hash members whose size appears on the other side
+	sizesB := map[uint64][]string{}
+	for _, k := range onlyB {
+		sizesB[filesB[k].size] = append(sizesB[filesB[k].size], k)
+	}
+	for _, ka := range onlyA {
+		cands := sizesB[filesA[ka].size]
+		if len(cands) == 0 {
+			continue
+		}
+		sumA, err := filesA[ka].sha256()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[WARN] cannot read %s from archive A: %v\n", filesA[ka].name, err)
+			continue
+		}
+		for _, kb := range cands {
+			if usedB[kb] {
+				continue
+			}
+			sumB, err := filesB[kb].sha256()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "[WARN] cannot read %s from archive B: %v\n", filesB[kb].name, err)
+				continue
+			}
+			if bytes.Equal(sumA, sumB) {
+				pairs = append(pairs, renamePair{keyA: ka, keyB: kb, similarity: 1, exact: true})
+				usedA[ka], usedB[kb] = true, true
+				break
+			}
+		}
+	}
+
+	// Similar text: compare line multisets of the remaining text members
+	if threshold > 0 && threshold <= 1 {
+		printsA := lineFingerprints(filesA, onlyA, usedA, diff, "A")
+		printsB := lineFingerprints(filesB, onlyB, usedB, diff, "B")
+
+		var cands []renamePair
+		for _, ka := range onlyA {
+			fa, ok := printsA[ka]
+			if !ok {
+				continue
+			}
+			for _, kb := range onlyB {
+				fb, ok := printsB[kb]
+				if !ok {
+					continue
+				}
+				if s := fa.similarity(fb); s >= threshold {
+					cands = append(cands, renamePair{keyA: ka, keyB: kb, similarity: s})
+				}
+			}
+		}
+		sort.SliceStable(cands, func(i, j int) bool {
+			return cands[i].similarity > cands[j].similarity
+		})
+		for _, c := range cands {
+			if usedA[c.keyA] || usedB[c.keyB] {
+				continue
+			}
+			pairs = append(pairs, c)
+			usedA[c.keyA], usedB[c.keyB] = true, true
+		}
+	}
+
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].keyA < pairs[j].keyA })
+	return pairs, without(onlyA, usedA), without(onlyB, usedB)
+}
+
+// lineFingerprint counts line hashes of a text member
+type lineFingerprint struct {
+	counts map[uint64]int
+	total  int
+}
+
+// similarity is the Dice coefficient of two line multisets
+func (f lineFingerprint) similarity(o lineFingerprint) float64 {
+	if f.total+o.total == 0 {
+		return 1
+	}
+	// Walk the smaller multiset
+	small, large := f, o
+	if len(small.counts) > len(large.counts) {
+		small, large = large, small
+	}
+	common := 0
+	for h, c := range small.counts {
+		common += min(c, large.counts[h])
+	}
+	return 2 * float64(common) / float64(f.total+o.total)
+}
+
+func lineFingerprints(files map[string]*archiveMember, keys []string, used map[string]bool, diff DiffOpts, side string) map[string]lineFingerprint {
+	out := map[string]lineFingerprint{}
+	for _, k := range keys {
+		m := files[k]
+		if used[k] || m.binary || m.size > maxDiffBytes {
+			continue
+		}
+		content, err := m.read(maxDiffBytes)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[WARN] cannot read %s from archive %s: %v\n", m.name, side, err)
+			continue
+		}
+		if !isLikelyText(content) {
+			continue
+		}
+		fp := lineFingerprint{counts: map[uint64]int{}}
+		for _, l := range splitLines(content) {
+			h := fnv.New64a()
+			h.Write([]byte(normalizeDiffLine(l, diff)))
+			fp.counts[h.Sum64()]++
+			fp.total++
+		}
+		out[k] = fp
+	}
+	return out
+}
+
+func without(keys []string, used map[string]bool) []string {
+	out := keys[:0:0]
+	for _, k := range keys {
+		if !used[k] {
+			out = append(out, k)
+		}
+	}
+	return out
+}
@@ -0,0 +1,205 @@
+package ops
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"unicode/utf8"
+
+	"github.com/c-a-ray/dkit/internal/core"
+	"gopkg.in/yaml.v3"
+)
+
+// Schema declares the expected shape of a delimited file
+// Ordered requires the declared columns to appear in the listed order;
+// AllowExtra permits columns that are not declared
+type Schema struct {
+	Ordered    bool           `yaml:"ordered,omitempty"`
+	AllowExtra bool           `yaml:"allow_extra,omitempty"`
+	Columns    []SchemaColumn `yaml:"columns"`
+}
+
+// SchemaColumn declares one column
+// Required and Nullable default to true when omitted; Pattern must match
+// the whole (trimmed) value; MaxLength counts characters
+type SchemaColumn struct {
+	Name      string   `yaml:"name"`
+	Type      string   `yaml:"type,omitempty"`
+	Required  *bool    `yaml:"required,omitempty"`
+	Nullable  *bool    `yaml:"nullable,omitempty"`
+	Unique    bool     `yaml:"unique,omitempty"`
+	MaxLength int      `yaml:"max_length,omitempty"`
+	Pattern   string   `yaml:"pattern,omitempty"`
+	Allowed   []string `yaml:"allowed,omitempty"`
+}
+
+func (c SchemaColumn) isRequired() bool { return c.Required == nil || *c.Required }
+func (c SchemaColumn) isNullable() bool { return c.Nullable == nil || *c.Nullable }
+
+// LoadSchema reads a YAML schema, rejecting unknown keys so typos in rule
+// names are not silently ignored
+func LoadSchema(path string) (Schema, error) {
+	var s Schema
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return s, err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&s); err != nil {
+		return s, fmt.Errorf("invalid schema %s: %w", path, err)
+	}
+	if len(s.Columns) == 0 {
+		return s, fmt.Errorf("invalid schema %s: no columns declared", path)
+	}
+	return s, nil
+}
+
+// SchemaInferOpts configures schema inference
+// MaxEnum is the most distinct values a column may have to be recorded as
+// an allowed set; values must also repeat, so ID-like columns are skipped
+type SchemaInferOpts struct {
+	MaxEnum       int
+	ExactDistinct int
+	TypeThreshold float64
+	Config        *core.Config
+}
+
+// InferSchema scans files and builds a schema that the data satisfies:
+// inferred types, nullability, enumerations for low-cardinality columns,
+// and maximum lengths
+func InferSchema(files []string, o SchemaInferOpts) (Schema, error) {
+	profiles, err := ProfileColumns(files, ProfileOpts{
+		Top:           o.MaxEnum + 1,
+		ExactDistinct: o.ExactDistinct,
+		TypeThreshold: o.TypeThreshold,
+		Config:        o.Config,
+	})
+	if err != nil {
+		return Schema{}, err
+	}
+
+	seenIn := 0
+	for _, p := range profiles {
+		seenIn = max(seenIn, p.Files)
+	}
+
+	s := Schema{Columns: make([]SchemaColumn, 0, len(profiles))}
+	for _, p := range profiles {
+		c := SchemaColumn{Name: p.Name, MaxLength: p.MaxLength}
+		if p.Type != "empty" {
+			c.Type = p.Type
+		}
+		if p.Files < seenIn {
+			c.Required = new(bool)
+		}
+		if p.Nulls == 0 && p.Rows > 0 {
+			c.Nullable = new(bool)
+		}
+
+		nonEmpty := p.Rows - p.Nulls
+		if !p.DistinctApprox && p.Distinct > 0 && p.Distinct <= uint64(o.MaxEnum) && uint64(nonEmpty) >= 2*p.Distinct {
+			for _, vf := range p.TopValues {
+				c.Allowed = append(c.Allowed, vf.Value)
+			}
+			slices.Sort(c.Allowed)
+		}
+		s.Columns = append(s.Columns, c)
+	}
+	return s, nil
+}
+
+// WriteSchema encodes a schema as YAML to path, or stdout if path is empty
+func WriteSchema(path string, s Schema) error {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(s); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	if path == "" {
+		_, err := os.Stdout.Write(buf.Bytes())
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+// columnRule is a SchemaColumn compiled for validation
+type columnRule struct {
+	SchemaColumn
+	vt      valueType
+	typed   bool
+	re      *regexp.Regexp
+	allowed map[string]bool
+}
+
+func (s Schema) compile() ([]*columnRule, error) {
+	rules := make([]*columnRule, 0, len(s.Columns))
+	seen := map[string]bool{}
+	for i, c := range s.Columns {
+		if c.Name == "" {
+			return nil, fmt.Errorf("column %d: missing name", i+1)
+		}
+		if seen[c.Name] {
+			return nil, fmt.Errorf("column %q declared twice", c.Name)
+		}
+		seen[c.Name] = true
+
+		r := &columnRule{SchemaColumn: c}
+		if c.Type != "" {
+			vt, err := parseValueType(c.Type)
+			if err != nil {
+				return nil, fmt.Errorf("column %q: %w", c.Name, err)
+			}
+			r.vt, r.typed = vt, vt != typeText
+		}
+		if c.Pattern != "" {
+			re, err := regexp.Compile(`^(?:` + c.Pattern + `)$`)
+			if err != nil {
+				return nil, fmt.Errorf("column %q: invalid pattern: %w", c.Name, err)
+			}
+			r.re = re
+		}
+		if len(c.Allowed) > 0 {
+			r.allowed = make(map[string]bool, len(c.Allowed))
+			for _, v := range c.Allowed {
+				r.allowed[v] = true
+			}
+		}
+		rules = append(rules, r)
+	}
+	if len(rules) == 0 {
+		return nil, errors.New("no columns declared")
+	}
+	return rules, nil
+}
+
+// check returns the rule and message for the first rule a non-unique check
+// fails, or empty strings if the value is valid
+func (r *columnRule) check(v string) (string, string) {
+	if v == "" {
+		if !r.isNullable() {
+			return "nullable", "empty value in non-nullable column"
+		}
+		return "", ""
+	}
+	if r.typed && !valueTypeMatches(r.vt, v) {
+		return "type", fmt.Sprintf("not a valid %s", r.vt)
+	}
+	if r.MaxLength > 0 && utf8.RuneCountInString(v) > r.MaxLength {
+		return "max_length", fmt.Sprintf("longer than %d characters", r.MaxLength)
+	}
+	if r.re != nil && !r.re.MatchString(v) {
+		return "pattern", fmt.Sprintf("does not match pattern %q", r.Pattern)
+	}
+	if r.allowed != nil && !r.allowed[v] {
+		return "allowed", "not an allowed value"
+	}
+	return "", ""
+}
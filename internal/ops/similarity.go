@@ -0,0 +1,399 @@
+package ops
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Similarity names a way of deciding whether two values are near-identical
+type Similarity string
+
+const (
+	SimNone        Similarity = ""
+	SimJaroWinkler Similarity = "jaro-winkler"
+	SimLevenshtein Similarity = "levenshtein"
+	SimSoundex     Similarity = "soundex"
+	SimMetaphone   Similarity = "metaphone"
+)
+
+// ParseSimilarity validates a similarity name
+func ParseSimilarity(s string) (Similarity, error) {
+	switch sim := Similarity(strings.ToLower(s)); sim {
+	case SimNone, SimJaroWinkler, SimLevenshtein, SimSoundex, SimMetaphone:
+		return sim, nil
+	case "jw":
+		return SimJaroWinkler, nil
+	}
+	return SimNone, fmt.Errorf("unknown similarity %q (expected jaro-winkler, levenshtein, soundex, or metaphone)", s)
+}
+
+// ParseFieldSimilarity reads a --similarity spec for the BY columns: one
+// method for every column, or FIELD=METHOD pairs naming the columns to
+// compare loosely, leaving the rest to match exactly
+func ParseFieldSimilarity(spec string, by []string) ([]Similarity, error) {
+	sims := make([]Similarity, len(by))
+	if !strings.Contains(spec, "=") {
+		sim, err := ParseSimilarity(spec)
+		if err != nil {
+			return nil, err
+		}
+		for i := range sims {
+			sims[i] = sim
+		}
+		return sims, nil
+	}
+	for _, part := range strings.Split(spec, ",") {
+		name, method, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("expected FIELD=METHOD, got %q", part)
+		}
+		i := slices.Index(by, strings.TrimSpace(name))
+		if i < 0 {
+			return nil, fmt.Errorf("%q is not a --by column", strings.TrimSpace(name))
+		}
+		sim, err := ParseSimilarity(strings.TrimSpace(method))
+		if err != nil {
+			return nil, err
+		}
+		sims[i] = sim
+	}
+	return sims, nil
+}
+
+// anySimilarity reports whether any field is compared loosely
+func anySimilarity(sims []Similarity) bool {
+	return slices.ContainsFunc(sims, func(s Similarity) bool { return s != SimNone })
+}
+
+// describeSimilarity names the method, or each loosely compared field's
+// method when they differ
+func describeSimilarity(by []string, sims []Similarity) string {
+	var names, methods []string
+	for i, s := range sims {
+		if s != SimNone && i < len(by) {
+			names = append(names, by[i])
+			methods = append(methods, string(s))
+		}
+	}
+	if len(names) == len(sims) && len(slices.Compact(slices.Clone(methods))) == 1 {
+		return methods[0]
+	}
+	parts := make([]string, len(names))
+	for i := range names {
+		parts[i] = names[i] + "=" + methods[i]
+	}
+	return strings.Join(parts, ", ")
+}
+
+// defaultThreshold is used when no threshold is given; phonetic methods
+// compare codes for equality and ignore it
+func (s Similarity) defaultThreshold() float64 {
+	switch s {
+	case SimJaroWinkler:
+		return 0.9
+	case SimLevenshtein:
+		return 0.75
+	}
+	return 0
+}
+
+// similar reports whether a and b are near-identical under s: a score of at
+// least threshold (or the method's default, if 0) for Jaro-Winkler and
+// Levenshtein, or equal codes for the phonetic methods
+// SimNone, and values without letters such as dates and numeric IDs, must
+// match exactly
+func (s Similarity) similar(a, b string, threshold float64) bool {
+	if s == SimNone {
+		return a == b
+	}
+	a, b = strings.ToLower(a), strings.ToLower(b)
+	if a == b {
+		return true
+	}
+	if lettersOnly(a) == "" || lettersOnly(b) == "" {
+		return false
+	}
+	if threshold <= 0 {
+		threshold = s.defaultThreshold()
+	}
+	switch s {
+	case SimJaroWinkler:
+		return jaroWinkler(a, b) >= threshold
+	case SimLevenshtein:
+		return levenshteinSimilarity(a, b) >= threshold
+	case SimSoundex:
+		ca, cb := soundex(a), soundex(b)
+		return ca != "" && ca == cb
+	case SimMetaphone:
+		ca, cb := metaphone(a), metaphone(b)
+		return ca != "" && ca == cb
+	}
+	return false
+}
+
+// jaroWinkler returns the Jaro-Winkler similarity of a and b in [0, 1]
+func jaroWinkler(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 && len(rb) == 0 {
+		return 1
+	}
+	if len(ra) == 0 || len(rb) == 0 {
+		return 0
+	}
+
+	window := max(max(len(ra), len(rb))/2-1, 0)
+	matchA := make([]bool, len(ra))
+	matchB := make([]bool, len(rb))
+	matches := 0
+	for i := range ra {
+		lo, hi := max(0, i-window), min(len(rb), i+window+1)
+		for j := lo; j < hi; j++ {
+			if !matchB[j] && ra[i] == rb[j] {
+				matchA[i], matchB[j] = true, true
+				matches++
+				break
+			}
+		}
+	}
+	if matches == 0 {
+		return 0
+	}
+
+	transpositions := 0
+	j := 0
+	for i := range ra {
+		if !matchA[i] {
+			continue
+		}
+		for !matchB[j] {
+			j++
+		}
+		if ra[i] != rb[j] {
+			transpositions++
+		}
+		j++
+	}
+
+	m := float64(matches)
+	jaro := (m/float64(len(ra)) + m/float64(len(rb)) + (m-float64(transpositions)/2)/m) / 3
+
+	prefix := 0
+	for prefix < min(4, len(ra), len(rb)) && ra[prefix] == rb[prefix] {
+		prefix++
+	}
+	return jaro + float64(prefix)*0.1*(1-jaro)
+}
+
+// levenshtein returns the edit distance between a and b in runes
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// levenshteinSimilarity scales edit distance to [0, 1] by the longer length
+func levenshteinSimilarity(a, b string) float64 {
+	n := max(len([]rune(a)), len([]rune(b)))
+	if n == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(a, b))/float64(n)
+}
+
+// lettersOnly upper-cases s and drops everything but ASCII letters
+func lettersOnly(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(s) {
+		if r >= 'A' && r <= 'Z' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+var soundexCodes = [26]byte{
+	// A  B    C    D    E  F    G    H  I  J    K    L    M    N    O  P    Q    R    S    T    U  V    W  X    Y  Z
+	0, '1', '2', '3', 0, '1', '2', 0, 0, '2', '2', '4', '5', '5', 0, '1', '2', '6', '2', '3', 0, '1', 0, '2', 0, '2',
+}
+
+// soundex returns the American Soundex code of s, or "" if s has no letters
+func soundex(s string) string {
+	w := lettersOnly(s)
+	if w == "" {
+		return ""
+	}
+	out := []byte{w[0]}
+	last := soundexCodes[w[0]-'A']
+	for i := 1; i < len(w) && len(out) < 4; i++ {
+		c := w[i]
+		code := soundexCodes[c-'A']
+		if code != 0 && code != last {
+			out = append(out, code)
+		}
+		// H and W do not separate letters with the same code; vowels do
+		if c != 'H' && c != 'W' {
+			last = code
+		}
+	}
+	for len(out) < 4 {
+		out = append(out, '0')
+	}
+	return string(out)
+}
+
+func isVowel(c byte) bool {
+	return strings.IndexByte("AEIOU", c) >= 0
+}
+
+// metaphone returns the original Metaphone key of s, or "" if s has no
+// letters
+func metaphone(s string) string {
+	w := lettersOnly(s)
+	if w == "" {
+		return ""
+	}
+
+	// Initial letter exceptions
+	switch {
+	case strings.HasPrefix(w, "KN"), strings.HasPrefix(w, "GN"), strings.HasPrefix(w, "PN"),
+		strings.HasPrefix(w, "AE"), strings.HasPrefix(w, "WR"):
+		w = w[1:]
+	case w[0] == 'X':
+		w = "S" + w[1:]
+	case strings.HasPrefix(w, "WH"):
+		w = "W" + w[2:]
+	}
+
+	at := func(i int) byte {
+		if i < 0 || i >= len(w) {
+			return 0
+		}
+		return w[i]
+	}
+	frontVowel := func(c byte) bool { return c == 'E' || c == 'I' || c == 'Y' }
+
+	var out strings.Builder
+	for i := 0; i < len(w); i++ {
+		c := w[i]
+		// Skip doubled letters except C
+		if c != 'C' && i > 0 && at(i-1) == c {
+			continue
+		}
+		switch c {
+		case 'A', 'E', 'I', 'O', 'U':
+			if i == 0 {
+				out.WriteByte(c)
+			}
+		case 'B':
+			if !(i == len(w)-1 && at(i-1) == 'M') {
+				out.WriteByte('B')
+			}
+		case 'C':
+			switch {
+			case at(i+1) == 'I' && at(i+2) == 'A':
+				out.WriteByte('X')
+			case at(i+1) == 'H':
+				if at(i-1) == 'S' {
+					out.WriteByte('K')
+				} else {
+					out.WriteByte('X')
+				}
+				i++
+			case frontVowel(at(i + 1)):
+				if at(i-1) != 'S' {
+					out.WriteByte('S')
+				}
+			default:
+				out.WriteByte('K')
+			}
+		case 'D':
+			if at(i+1) == 'G' && frontVowel(at(i+2)) {
+				out.WriteByte('J')
+				i++
+			} else {
+				out.WriteByte('T')
+			}
+		case 'G':
+			switch {
+			case at(i+1) == 'H' && i+2 < len(w) && !isVowel(at(i+2)):
+				// silent, as in "night"
+			case at(i+1) == 'N' && (i+2 == len(w) || (at(i+2) == 'E' && at(i+3) == 'D' && i+4 == len(w))):
+				// silent, as in "sign" or "signed"
+			case frontVowel(at(i+1)) && at(i-1) != 'G':
+				out.WriteByte('J')
+			default:
+				out.WriteByte('K')
+			}
+		case 'H':
+			prevSilent := strings.IndexByte("CSPTG", at(i-1)) >= 0
+			if !prevSilent && !(isVowel(at(i-1)) && !isVowel(at(i+1))) {
+				out.WriteByte('H')
+			}
+		case 'K':
+			if at(i-1) != 'C' {
+				out.WriteByte('K')
+			}
+		case 'P':
+			if at(i+1) == 'H' {
+				out.WriteByte('F')
+				i++
+			} else {
+				out.WriteByte('P')
+			}
+		case 'Q':
+			out.WriteByte('K')
+		case 'S':
+			switch {
+			case at(i+1) == 'H':
+				out.WriteByte('X')
+				i++
+			case at(i+1) == 'I' && (at(i+2) == 'O' || at(i+2) == 'A'):
+				out.WriteByte('X')
+			default:
+				out.WriteByte('S')
+			}
+		case 'T':
+			switch {
+			case at(i+1) == 'I' && (at(i+2) == 'O' || at(i+2) == 'A'):
+				out.WriteByte('X')
+			case at(i+1) == 'H':
+				out.WriteByte('0')
+				i++
+			case at(i+1) == 'C' && at(i+2) == 'H':
+				// silent, as in "match"
+			default:
+				out.WriteByte('T')
+			}
+		case 'V':
+			out.WriteByte('F')
+		case 'W', 'Y':
+			if isVowel(at(i + 1)) {
+				out.WriteByte(c)
+			}
+		case 'X':
+			out.WriteString("KS")
+		case 'Z':
+			out.WriteByte('S')
+		default:
+			// F, J, L, M, N, R
+			out.WriteByte(c)
+		}
+	}
+	return out.String()
+}
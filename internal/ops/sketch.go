@@ -0,0 +1,226 @@
+package ops
+
+import (
+	"container/heap"
+	"hash/maphash"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// hyperLogLog estimates the number of distinct strings in fixed memory
+// (2^precision bytes); the standard error is about 1.04/sqrt(2^precision)
+type hyperLogLog struct {
+	p    uint8
+	regs []uint8
+}
+
+// hllSeed is shared so sketches built in one run can be merged
+var hllSeed = maphash.MakeSeed()
+
+func newHyperLogLog(precision uint8) *hyperLogLog {
+	return &hyperLogLog{p: precision, regs: make([]uint8, 1<<precision)}
+}
+
+func (h *hyperLogLog) add(s string) {
+	x := maphash.String(hllSeed, s)
+	idx := x >> (64 - h.p)
+	w := x<<h.p | 1<<(h.p-1)
+	if rho := uint8(bits.LeadingZeros64(w) + 1); rho > h.regs[idx] {
+		h.regs[idx] = rho
+	}
+}
+
+func (h *hyperLogLog) count() uint64 {
+	m := float64(len(h.regs))
+	sum := 0.0
+	zeros := 0
+	for _, r := range h.regs {
+		sum += 1 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+	est := 0.7213 / (1 + 1.079/m) * m * m / sum
+	// Small-range correction: linear counting is more accurate
+	if est <= 2.5*m && zeros > 0 {
+		est = m * math.Log(m/float64(zeros))
+	}
+	return uint64(est + 0.5)
+}
+
+// valueCount is a value with its (possibly approximate) count
+type valueCount struct {
+	value string
+	count int64
+}
+
+// spaceSaving tracks approximate top-k frequencies in bounded memory using
+// the Space-Saving algorithm; counts may overestimate by at most the
+// smallest tracked count
+type spaceSaving struct {
+	cap     int
+	entries map[string]*ssEntry
+	h       ssHeap
+}
+
+type ssEntry struct {
+	value string
+	count int64
+	index int
+}
+
+func newSpaceSaving(capacity int) *spaceSaving {
+	return &spaceSaving{cap: max(capacity, 1), entries: map[string]*ssEntry{}}
+}
+
+func (s *spaceSaving) add(v string, n int64) {
+	if e, ok := s.entries[v]; ok {
+		e.count += n
+		heap.Fix(&s.h, e.index)
+		return
+	}
+	if len(s.h) < s.cap {
+		e := &ssEntry{value: v, count: n}
+		heap.Push(&s.h, e)
+		s.entries[v] = e
+		return
+	}
+	// Replace the smallest entry, inheriting its count as the error bound
+	e := s.h[0]
+	delete(s.entries, e.value)
+	e.value = v
+	e.count += n
+	s.entries[v] = e
+	heap.Fix(&s.h, 0)
+}
+
+// top returns up to n tracked values by descending count
+func (s *spaceSaving) top(n int) []valueCount {
+	out := make([]valueCount, 0, len(s.h))
+	for _, e := range s.h {
+		out = append(out, valueCount{e.value, e.count})
+	}
+	sortValueCounts(out)
+	if n > 0 && len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
+
+// overcount bounds how far any tracked count may exceed the true count
+func (s *spaceSaving) overcount() int64 {
+	if len(s.h) < s.cap {
+		return 0
+	}
+	return s.h[0].count
+}
+
+type ssHeap []*ssEntry
+
+func (h ssHeap) Len() int           { return len(h) }
+func (h ssHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+func (h ssHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *ssHeap) Push(x any) {
+	e := x.(*ssEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+func (h *ssHeap) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
+
+// sortValueCounts orders by count descending, then value ascending
+func sortValueCounts(vc []valueCount) {
+	sort.Slice(vc, func(i, j int) bool {
+		if vc[i].count == vc[j].count {
+			return vc[i].value < vc[j].value
+		}
+		return vc[i].count > vc[j].count
+	})
+}
+
+// distinctCounter counts distinct values exactly until limit distinct
+// values have been seen, then switches to a HyperLogLog estimate for the
+// count and Space-Saving for the most frequent values
+type distinctCounter struct {
+	limit  int
+	exact  map[string]int64
+	hll    *hyperLogLog
+	topk   *spaceSaving
+	topCap int
+}
+
+func newDistinctCounter(limit, topCap int) *distinctCounter {
+	return &distinctCounter{limit: limit, exact: map[string]int64{}, topCap: topCap}
+}
+
+func (d *distinctCounter) add(v string) {
+	if d.hll != nil {
+		d.hll.add(v)
+		d.topk.add(v, 1)
+		return
+	}
+	d.exact[v]++
+	if d.limit > 0 && len(d.exact) > d.limit {
+		d.spill()
+	}
+}
+
+func (d *distinctCounter) spill() {
+	d.hll = newHyperLogLog(14)
+	all := make([]valueCount, 0, len(d.exact))
+	for v, c := range d.exact {
+		d.hll.add(v)
+		all = append(all, valueCount{v, c})
+	}
+	sortValueCounts(all)
+	d.topk = newSpaceSaving(d.topCap)
+	for _, vc := range all[:min(len(all), d.topCap)] {
+		d.topk.add(vc.value, vc.count)
+	}
+	d.exact = nil
+}
+
+// approximate reports whether the counter has switched to estimates
+func (d *distinctCounter) approximate() bool {
+	return d.hll != nil
+}
+
+func (d *distinctCounter) distinct() uint64 {
+	if d.hll != nil {
+		return d.hll.count()
+	}
+	return uint64(len(d.exact))
+}
+
+// overcount bounds how far counts from top may exceed the true counts
+func (d *distinctCounter) overcount() int64 {
+	if d.topk == nil {
+		return 0
+	}
+	return d.topk.overcount()
+}
+
+// top returns the n most frequent values
+func (d *distinctCounter) top(n int) []valueCount {
+	if d.topk != nil {
+		return d.topk.top(n)
+	}
+	out := make([]valueCount, 0, len(d.exact))
+	for v, c := range d.exact {
+		out = append(out, valueCount{v, c})
+	}
+	sortValueCounts(out)
+	if n > 0 && len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
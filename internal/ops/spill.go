@@ -0,0 +1,253 @@
+package ops
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// externalSorter sorts value counts that may not fit in memory: records are
+// buffered up to limit, then sorted and written to run files in a temporary
+// directory, and finally merged
+type externalSorter struct {
+	dir   string
+	limit int
+	less  func(a, b valueCount) bool
+	buf   []valueCount
+	runs  []string
+}
+
+// byValue orders records by value
+func byValue(a, b valueCount) bool { return a.value < b.value }
+
+// byCountDesc orders records by count descending, then value
+func byCountDesc(a, b valueCount) bool {
+	if a.count != b.count {
+		return a.count > b.count
+	}
+	return a.value < b.value
+}
+
+// newExternalSorter creates a sorter whose runs are written under a new
+// temporary directory in dir (the system default if empty)
+func newExternalSorter(dir string, limit int, less func(a, b valueCount) bool) (*externalSorter, error) {
+	tmp, err := os.MkdirTemp(dir, "dkit-spill-*")
+	if err != nil {
+		return nil, err
+	}
+	return &externalSorter{dir: tmp, limit: max(limit, 1), less: less}, nil
+}
+
+func (s *externalSorter) add(vc valueCount) error {
+	s.buf = append(s.buf, vc)
+	if len(s.buf) >= s.limit {
+		return s.flush()
+	}
+	return nil
+}
+
+// flush sorts the buffer and writes it as a run
+func (s *externalSorter) flush() error {
+	if len(s.buf) == 0 {
+		return nil
+	}
+	sort.Slice(s.buf, func(i, j int) bool { return s.less(s.buf[i], s.buf[j]) })
+
+	path := filepath.Join(s.dir, fmt.Sprintf("run-%05d", len(s.runs)))
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriterSize(f, 1<<16)
+	var tmp [binary.MaxVarintLen64]byte
+	for _, vc := range s.buf {
+		// Records are length-prefixed so values may hold any bytes
+		w.Write(tmp[:binary.PutUvarint(tmp[:], uint64(len(vc.value)))])
+		w.WriteString(vc.value)
+		w.Write(tmp[:binary.PutVarint(tmp[:], vc.count)])
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	s.runs = append(s.runs, path)
+	s.buf = s.buf[:0]
+	return nil
+}
+
+// merge returns an iterator over all records in order; with combine,
+// records with equal values are summed into one
+func (s *externalSorter) merge(combine bool) (*runMerger, error) {
+	if err := s.flush(); err != nil {
+		return nil, err
+	}
+	m := &runMerger{less: s.less, combine: combine}
+	for _, path := range s.runs {
+		f, err := os.Open(path)
+		if err != nil {
+			m.close()
+			return nil, err
+		}
+		r := &runReader{r: bufio.NewReaderSize(f, 1<<16)}
+		m.files = append(m.files, f)
+		if ok, err := r.next(); err != nil {
+			m.close()
+			return nil, err
+		} else if ok {
+			m.h = append(m.h, r)
+		}
+	}
+	heap.Init(m)
+	return m, nil
+}
+
+// remove deletes the sorter's temporary directory
+func (s *externalSorter) remove() error {
+	return os.RemoveAll(s.dir)
+}
+
+// runReader reads records from one run file
+type runReader struct {
+	r   *bufio.Reader
+	cur valueCount
+}
+
+func (r *runReader) next() (bool, error) {
+	n, err := binary.ReadUvarint(r.r)
+	if err == io.EOF {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		return false, err
+	}
+	c, err := binary.ReadVarint(r.r)
+	if err != nil {
+		return false, err
+	}
+	r.cur = valueCount{string(b), c}
+	return true, nil
+}
+
+// runMerger is a k-way merge of run files ordered by less
+type runMerger struct {
+	h       []*runReader
+	files   []*os.File
+	less    func(a, b valueCount) bool
+	combine bool
+	err     error
+}
+
+func (m *runMerger) Len() int           { return len(m.h) }
+func (m *runMerger) Less(i, j int) bool { return m.less(m.h[i].cur, m.h[j].cur) }
+func (m *runMerger) Swap(i, j int)      { m.h[i], m.h[j] = m.h[j], m.h[i] }
+func (m *runMerger) Push(x any)         { m.h = append(m.h, x.(*runReader)) }
+func (m *runMerger) Pop() any {
+	r := m.h[len(m.h)-1]
+	m.h = m.h[:len(m.h)-1]
+	return r
+}
+
+// pop removes and returns the smallest record
+func (m *runMerger) pop() (valueCount, bool) {
+	if len(m.h) == 0 || m.err != nil {
+		return valueCount{}, false
+	}
+	r := m.h[0]
+	vc := r.cur
+	ok, err := r.next()
+	if err != nil {
+		m.err = err
+		return valueCount{}, false
+	}
+	if ok {
+		heap.Fix(m, 0)
+	} else {
+		heap.Pop(m)
+	}
+	return vc, true
+}
+
+// next returns the next record, summing equal values when combining
+func (m *runMerger) next() (valueCount, bool) {
+	vc, ok := m.pop()
+	if !ok || !m.combine {
+		return vc, ok
+	}
+	for len(m.h) > 0 && m.h[0].cur.value == vc.value {
+		more, _ := m.pop()
+		vc.count += more.count
+	}
+	return vc, m.err == nil
+}
+
+func (m *runMerger) close() error {
+	var errs []error
+	for _, f := range m.files {
+		errs = append(errs, f.Close())
+	}
+	m.files = nil
+	return errors.Join(errs...)
+}
+
+// spillCounter counts values exactly in bounded memory: once limit distinct
+// values are held, the counts are sorted by value and spilled to disk, then
+// merged at the end
+type spillCounter struct {
+	limit  int
+	counts map[string]int64
+	sorter *externalSorter
+	err    error
+}
+
+func newSpillCounter(dir string, limit int) (*spillCounter, error) {
+	s, err := newExternalSorter(dir, limit, byValue)
+	if err != nil {
+		return nil, err
+	}
+	return &spillCounter{limit: max(limit, 1), counts: map[string]int64{}, sorter: s}, nil
+}
+
+func (c *spillCounter) add(v string) {
+	if c.err != nil {
+		return
+	}
+	c.counts[v]++
+	if len(c.counts) >= c.limit {
+		c.err = c.spill()
+	}
+}
+
+func (c *spillCounter) spill() error {
+	for v, n := range c.counts {
+		c.sorter.buf = append(c.sorter.buf, valueCount{v, n})
+	}
+	clear(c.counts)
+	return c.sorter.flush()
+}
+
+// sorted returns the merged counts ordered by value
+func (c *spillCounter) sorted() (*runMerger, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	if err := c.spill(); err != nil {
+		return nil, err
+	}
+	return c.sorter.merge(true)
+}
+
+func (c *spillCounter) remove() error {
+	return c.sorter.remove()
+}
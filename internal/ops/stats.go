@@ -0,0 +1,342 @@
+package ops
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/c-a-ray/dkit/internal/core"
+)
+
+// StatsOpts configures numeric column statistics
+// Percentiles are in 0-100; the median is always reported
+// ExactLimit is how many values per group are kept for exact quantiles
+// before switching to streaming estimates
+type StatsOpts struct {
+	Column      string
+	GroupBy     string
+	Percentiles []float64
+	ExactLimit  int
+	NullToken   string
+	Filter      Filter
+	Config      *core.Config
+}
+
+// numStats accumulates statistics for one group in a single pass
+type numStats struct {
+	count      int64
+	empty      int64
+	nonNumeric int64
+	min, max   float64
+	mean, m2   float64
+	values     []float64
+	sketches   []*p2Quantile
+}
+
+func (s *numStats) add(v float64, quantiles []float64, limit int) {
+	s.count++
+	if s.count == 1 {
+		s.min, s.max = v, v
+	} else {
+		s.min = math.Min(s.min, v)
+		s.max = math.Max(s.max, v)
+	}
+
+	// Welford's online mean and variance
+	d := v - s.mean
+	s.mean += d / float64(s.count)
+	s.m2 += d * (v - s.mean)
+
+	if s.sketches != nil {
+		for _, q := range s.sketches {
+			q.add(v)
+		}
+		return
+	}
+	s.values = append(s.values, v)
+	if limit > 0 && len(s.values) > limit {
+		s.sketches = make([]*p2Quantile, len(quantiles))
+		for i, p := range quantiles {
+			s.sketches[i] = newP2Quantile(p)
+			for _, x := range s.values {
+				s.sketches[i].add(x)
+			}
+		}
+		s.values = nil
+	}
+}
+
+func (s *numStats) stddev() float64 {
+	if s.count < 2 {
+		return math.NaN()
+	}
+	return math.Sqrt(s.m2 / float64(s.count-1))
+}
+
+// quantiles returns the requested quantiles and whether they are estimates
+func (s *numStats) quantiles(qs []float64) ([]float64, bool) {
+	out := make([]float64, len(qs))
+	if s.sketches != nil {
+		for i, q := range s.sketches {
+			out[i] = q.value()
+		}
+		return out, true
+	}
+	sort.Float64s(s.values)
+	for i, p := range qs {
+		out[i] = exactQuantile(s.values, p)
+	}
+	return out, false
+}
+
+// ColumnStats prints count, min, max, mean, standard deviation, median and
+// percentiles of a numeric column across files, optionally per group
+func ColumnStats(files []string, o StatsOpts) error {
+	if len(files) == 0 {
+		return errors.New("no files")
+	}
+
+	quantiles := []float64{0.5}
+	for _, p := range o.Percentiles {
+		if p < 0 || p > 100 {
+			return fmt.Errorf("percentile %v out of range 0-100", p)
+		}
+		if !slices.Contains(quantiles, p/100) {
+			quantiles = append(quantiles, p/100)
+		}
+	}
+	sort.Float64s(quantiles)
+
+	groups := map[string]*numStats{}
+	// Files with a header, and how many of them had the columns
+	headed, resolved := 0, 0
+
+	for _, path := range files {
+		rc, err := core.OpenWithEncoding(path, o.Config.Encoding)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[WARN] cannot read %s: %v\n", path, err)
+			continue
+		}
+		cr := core.NewCSVReader(rc, o.Config.Delim, o.Config.LazyQuotes)
+
+		idx, idxGroup := 0, -1
+		var resolvedFilter ResolvedFilter
+
+		if o.Config.NoHeader {
+			idx, err = parseIndex(o.Column)
+			if err != nil {
+				rc.Close()
+				return fmt.Errorf("--no-header requires numeric column index, got %q", o.Column)
+			}
+			if o.GroupBy != "" {
+				idxGroup, err = parseIndex(o.GroupBy)
+				if err != nil {
+					rc.Close()
+					return fmt.Errorf("--no-header requires numeric --group-by index, got %q", o.GroupBy)
+				}
+			}
+			if !o.Filter.IsEmpty() {
+				resolvedFilter, err = o.Filter.Resolve(nil, true)
+				if err != nil {
+					rc.Close()
+					return err
+				}
+			}
+		} else {
+			hdr, err := cr.Read()
+			if err == io.EOF {
+				fmt.Fprintf(os.Stderr, "[WARN] %s is empty\n", path)
+				rc.Close()
+				continue
+			} else if err != nil {
+				fmt.Fprintf(os.Stderr, "[WARN] %s: %v\n", path, err)
+				rc.Close()
+				continue
+			}
+			headed++
+			idx, err = resolveHeaderIndex(hdr, o.Column)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "[WARN] %s: %v\n", path, err)
+				rc.Close()
+				continue
+			}
+			if o.GroupBy != "" {
+				idxGroup, err = resolveHeaderIndex(hdr, o.GroupBy)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "[WARN] %s: %v\n", path, err)
+					rc.Close()
+					continue
+				}
+			}
+			resolved++
+			if !o.Filter.IsEmpty() {
+				resolvedFilter, err = o.Filter.Resolve(hdr, false)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "[WARN] %s: %v\n", path, err)
+					rc.Close()
+					continue
+				}
+			}
+		}
+
+		for {
+			rec, err := cr.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "[WARN] %s: %v\n", path, err)
+				break
+			}
+			if !resolvedFilter.Match(rec) {
+				continue
+			}
+
+			group := ""
+			if idxGroup >= 0 {
+				if idxGroup < len(rec) {
+					group = strings.TrimSpace(rec[idxGroup])
+				}
+				if group == "" {
+					group = o.NullToken
+				}
+			}
+			s := groups[group]
+			if s == nil {
+				s = &numStats{}
+				groups[group] = s
+			}
+
+			var v string
+			if idx < len(rec) {
+				v = strings.TrimSpace(rec[idx])
+			}
+			if v == "" {
+				s.empty++
+				continue
+			}
+			f, ok := parseNumber(v)
+			if !ok {
+				s.nonNumeric++
+				continue
+			}
+			s.add(f, quantiles, o.ExactLimit)
+		}
+		rc.Close()
+	}
+	if headed > 0 && resolved == 0 {
+		cols := []string{o.Column}
+		if o.GroupBy != "" {
+			cols = append(cols, o.GroupBy)
+		}
+		return fmt.Errorf("no file has column(s) %s", strings.Join(cols, ", "))
+	}
+
+	if len(groups) == 0 {
+		return nil
+	}
+
+	if o.GroupBy == "" {
+		printStats(groups[""], quantiles)
+		return nil
+	}
+	printGroupedStats(o.GroupBy, groups, quantiles)
+	return nil
+}
+
+// parseNumber parses a cell as a number, tolerating a leading currency sign
+// and thousands separators
+func parseNumber(s string) (float64, bool) {
+	s = strings.TrimPrefix(s, "$")
+	if strings.Contains(s, ",") {
+		s = strings.ReplaceAll(s, ",", "")
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, false
+	}
+	return f, true
+}
+
+func quantileLabel(p float64) string {
+	if p == 0.5 {
+		return "median"
+	}
+	return "p" + strconv.FormatFloat(p*100, 'f', -1, 64)
+}
+
+func formatStat(v float64) string {
+	if math.IsNaN(v) {
+		return "-"
+	}
+	return strconv.FormatFloat(math.Round(v*1e6)/1e6, 'f', -1, 64)
+}
+
+func printStats(s *numStats, quantiles []float64) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "count\t%d\n", s.count)
+	fmt.Fprintf(w, "empty\t%d\n", s.empty)
+	fmt.Fprintf(w, "non-numeric\t%d\n", s.nonNumeric)
+	if s.count > 0 {
+		qv, approx := s.quantiles(quantiles)
+		fmt.Fprintf(w, "min\t%s\n", formatStat(s.min))
+		fmt.Fprintf(w, "max\t%s\n", formatStat(s.max))
+		fmt.Fprintf(w, "mean\t%s\n", formatStat(s.mean))
+		fmt.Fprintf(w, "stddev\t%s\n", formatStat(s.stddev()))
+		for i, p := range quantiles {
+			label := quantileLabel(p)
+			if approx {
+				label += " (approx)"
+			}
+			fmt.Fprintf(w, "%s\t%s\n", label, formatStat(qv[i]))
+		}
+	}
+	w.Flush()
+}
+
+func printGroupedStats(groupCol string, groups map[string]*numStats, quantiles []float64) {
+	keys := make([]string, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\tcount\tempty\tnon-numeric\tmin\tmax\tmean\tstddev", groupCol)
+	for _, p := range quantiles {
+		fmt.Fprintf(w, "\t%s", quantileLabel(p))
+	}
+	fmt.Fprintln(w)
+
+	anyApprox := false
+	for _, k := range keys {
+		s := groups[k]
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d", k, s.count, s.empty, s.nonNumeric)
+		if s.count == 0 {
+			for range 4 + len(quantiles) {
+				fmt.Fprint(w, "\t-")
+			}
+			fmt.Fprintln(w)
+			continue
+		}
+		fmt.Fprintf(w, "\t%s\t%s\t%s\t%s", formatStat(s.min), formatStat(s.max), formatStat(s.mean), formatStat(s.stddev()))
+		qv, approx := s.quantiles(quantiles)
+		anyApprox = anyApprox || approx
+		for _, v := range qv {
+			fmt.Fprintf(w, "\t%s", formatStat(v))
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+
+	if anyApprox {
+		fmt.Fprintln(os.Stderr, "[INFO] quantiles for large groups are streaming estimates")
+	}
+}
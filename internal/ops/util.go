@@ -40,3 +40,27 @@ func joinKV(names, vals []string) string {
 	}
 	return strings.Join(parts, ", ")
 }
+
+// packFields encodes values as one map key that unpackFields can split back
+// exactly: each value is prefixed with its byte length, so no separator can
+// collide with the data
+func packFields(vals []string) string {
+	var b strings.Builder
+	for _, v := range vals {
+		b.WriteString(strconv.Itoa(len(v)))
+		b.WriteByte(':')
+		b.WriteString(v)
+	}
+	return b.String()
+}
+
+func unpackFields(s string) []string {
+	var vals []string
+	for s != "" {
+		n, rest, _ := strings.Cut(s, ":")
+		size, _ := strconv.Atoi(n)
+		vals = append(vals, rest[:size])
+		s = rest[size:]
+	}
+	return vals
+}
@@ -0,0 +1,256 @@
+package ops
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/c-a-ray/dkit/internal/core"
+)
+
+// ValidateOpts configures schema validation
+// MaxErrors caps how many violations are reported per file (0 for no limit);
+// every violation is still counted
+type ValidateOpts struct {
+	Schema    Schema
+	JSON      bool
+	MaxErrors int
+	Quiet     bool
+	Config    *core.Config
+}
+
+// Violation is one schema rule broken at a file, line, and column
+type Violation struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  string `json:"column,omitempty"`
+	Rule    string `json:"rule"`
+	Value   string `json:"value,omitempty"`
+	Message string `json:"message"`
+}
+
+// ValidateResult summarizes a validation run
+type ValidateResult struct {
+	Files       int         `json:"files"`
+	Rows        int64       `json:"rows"`
+	Violations  int         `json:"violations"`
+	InvalidFile int         `json:"invalid_files"`
+	Errors      []Violation `json:"errors"`
+}
+
+// validator carries state that spans files, such as values seen in unique
+// columns
+type validator struct {
+	o      ValidateOpts
+	rules  []*columnRule
+	seen   []map[string]string
+	res    ValidateResult
+	shown  int
+	hidden int
+}
+
+// Validate checks every file against o.Schema, reporting violations per
+// file, line, and column
+func Validate(files []string, o ValidateOpts) (ValidateResult, error) {
+	if len(files) == 0 {
+		return ValidateResult{}, errors.New("no files")
+	}
+	rules, err := o.Schema.compile()
+	if err != nil {
+		return ValidateResult{}, err
+	}
+
+	v := &validator{o: o, rules: rules, seen: make([]map[string]string, len(rules))}
+	for i, r := range rules {
+		if r.Unique {
+			v.seen[i] = map[string]string{}
+		}
+	}
+	v.res.Errors = []Violation{}
+
+	for _, path := range files {
+		before := v.res.Violations
+		if err := v.file(path); err != nil {
+			return v.res, err
+		}
+		v.res.Files++
+		if v.res.Violations > before {
+			v.res.InvalidFile++
+		}
+	}
+
+	if o.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return v.res, enc.Encode(v.res)
+	}
+
+	if !o.Quiet {
+		fmt.Fprintf(os.Stderr, "\n")
+		fmt.Fprintf(os.Stderr, "Files checked:  %d\n", v.res.Files)
+		fmt.Fprintf(os.Stderr, "Rows checked:   %d\n", v.res.Rows)
+		fmt.Fprintf(os.Stderr, "Invalid files:  %d\n", v.res.InvalidFile)
+		fmt.Fprintf(os.Stderr, "Violations:     %d\n", v.res.Violations)
+	}
+	return v.res, nil
+}
+
+// file checks one file; a file that cannot be opened or whose header cannot
+// be parsed is reported as a violation, since unread input must not pass
+// The error is reserved for problems with the schema itself
+func (v *validator) file(path string) error {
+	v.shown, v.hidden = 0, 0
+	defer func() {
+		if v.hidden > 0 && !v.o.JSON && !v.o.Quiet {
+			fmt.Printf("  ... (%d more violations in %s)\n", v.hidden, path)
+		}
+	}()
+
+	rc, err := core.OpenWithEncoding(path, v.o.Config.Encoding)
+	if err != nil {
+		v.report(Violation{File: path, Rule: "read", Message: err.Error()})
+		return nil
+	}
+	defer rc.Close()
+	cr := core.NewCSVReader(rc, v.o.Config.Delim, v.o.Config.LazyQuotes)
+	cr.FieldsPerRecord = -1
+
+	// idx maps each rule to its column index, or -1 if the column is absent
+	idx := make([]int, len(v.rules))
+	if v.o.Config.NoHeader {
+		for i, r := range v.rules {
+			idx[i], err = parseIndex(r.Name)
+			if err != nil {
+				return fmt.Errorf("--no-header requires numeric column names in the schema, got %q", r.Name)
+			}
+		}
+	} else {
+		hdr, err := cr.Read()
+		if err == io.EOF {
+			v.report(Violation{File: path, Line: 1, Rule: "header", Message: "file is empty"})
+			return nil
+		} else if err != nil {
+			v.report(Violation{File: path, Line: csvErrLine(err), Rule: "parse", Message: "cannot parse header: " + err.Error()})
+			return nil
+		}
+		v.checkHeader(path, hdr, idx)
+	}
+
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			v.report(Violation{File: path, Line: csvErrLine(err), Rule: "parse", Message: err.Error()})
+			break
+		}
+		v.res.Rows++
+		line, _ := cr.FieldPos(0)
+
+		for i, r := range v.rules {
+			if idx[i] < 0 {
+				continue
+			}
+			var val string
+			if idx[i] < len(rec) {
+				val = strings.TrimSpace(rec[idx[i]])
+			}
+
+			if rule, msg := r.check(val); rule != "" {
+				v.report(Violation{File: path, Line: line, Column: r.Name, Rule: rule, Value: val, Message: msg})
+				continue
+			}
+			if r.Unique && val != "" {
+				at := path + ":" + strconv.Itoa(line)
+				if first, dup := v.seen[i][val]; dup {
+					v.report(Violation{File: path, Line: line, Column: r.Name, Rule: "unique", Value: val, Message: "duplicate value (first seen at " + first + ")"})
+				} else {
+					v.seen[i][val] = at
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkHeader reports missing, extra, and out-of-order columns and fills idx
+func (v *validator) checkHeader(path string, hdr []string, idx []int) {
+	declared := make(map[string]bool, len(v.rules))
+	var present []string
+	for i, r := range v.rules {
+		declared[r.Name] = true
+		j, err := resolveHeaderIndex(hdr, r.Name)
+		if err != nil {
+			j = -1
+		}
+		idx[i] = j
+		if j >= 0 {
+			present = append(present, r.Name)
+		} else if r.isRequired() {
+			v.report(Violation{File: path, Line: 1, Column: r.Name, Rule: "required", Message: "missing required column"})
+		}
+	}
+
+	if !v.o.Schema.AllowExtra {
+		for _, h := range hdr {
+			if !declared[h] {
+				v.report(Violation{File: path, Line: 1, Column: h, Rule: "extra", Message: "column not declared in schema"})
+			}
+		}
+	}
+
+	if v.o.Schema.Ordered {
+		var got []string
+		for _, h := range hdr {
+			if declared[h] {
+				got = append(got, h)
+			}
+		}
+		if !slices.Equal(got, present) {
+			v.report(Violation{File: path, Line: 1, Rule: "order", Message: fmt.Sprintf("columns out of order: got %s, want %s", strings.Join(got, ", "), strings.Join(present, ", "))})
+		}
+	}
+}
+
+// report counts a violation and prints or records it, subject to MaxErrors
+func (v *validator) report(e Violation) {
+	v.res.Violations++
+	if v.o.MaxErrors > 0 && v.shown >= v.o.MaxErrors {
+		v.hidden++
+		return
+	}
+	v.shown++
+
+	if v.o.JSON {
+		v.res.Errors = append(v.res.Errors, e)
+		return
+	}
+	if v.o.Quiet {
+		return
+	}
+	loc := fmt.Sprintf("%s:%d", e.File, e.Line)
+	if e.Column != "" {
+		loc += fmt.Sprintf(" [%s]", e.Column)
+	}
+	if e.Value != "" {
+		fmt.Printf("✗ %s %s: %q\n", loc, e.Message, truncateLine(e.Value, 60))
+	} else {
+		fmt.Printf("✗ %s %s\n", loc, e.Message)
+	}
+}
+
+// csvErrLine extracts the line number from a CSV parse error
+func csvErrLine(err error) int {
+	var pe *csv.ParseError
+	if errors.As(err, &pe) {
+		return pe.Line
+	}
+	return 0
+}
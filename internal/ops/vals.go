@@ -6,9 +6,11 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"text/tabwriter"
 
 	"github.com/c-a-ray/dkit/internal/core"
 )
@@ -24,67 +26,218 @@ const (
 )
 
 // ValueOpts configures how column values are collected and printed
-// Column may be a header name or an index string when --no-header is set
-// FixedStart/FixedEnd enable fixed-width extraction (1-based, inclusive)
+// Columns may be header names or index strings when --no-header is set;
+// with several columns, their combined values are counted together
+// Fixed reads lines as fixed-width fields, which Columns and Filter name
+// Top and MinCount limit freq output; the values left out are summed into
+// an "other" row. Pct adds percentage columns and Totals a total row
+// ByFile breaks counts down per file; NewSince lists values first seen in
+// a file after the named one, in the order files were given
+// MaxValues bounds the distinct values held in memory: beyond it, Approx
+// switches to estimates and Spill sorts counts to disk under SpillDir
 type ValsOpts struct {
-	Column     string
-	Mode       ValsMode
-	NullToken  string
-	FixedStart int
-	FixedEnd   int
-	Filter     Filter // row filter conditions (--when flags)
-	Config     *core.Config
+	Columns   []string
+	Mode      ValsMode
+	NullToken string
+	Fixed     []FixedField
+	Top       int
+	MinCount  int
+	Pct       bool
+	Totals    bool
+	ByFile    bool
+	NewSince  string
+	Approx    bool
+	Spill     bool
+	SpillDir  string
+	MaxValues int
+	Filter    Filter // row filter conditions (--when flags)
+	Config    *core.Config
 }
 
-// ColumnValues prints values from the specified column across files,
+// ColumnValues prints values from the specified columns across files,
 // either as unique values or as value frequencies, per ValsOpts
 func ColumnValues(files []string, o ValsOpts) error {
 	if len(files) == 0 {
 		return errors.New("no files")
 	}
+
+	// Check for incompatible options
+	if o.Approx && o.Spill {
+		return errors.New("--approx and --spill cannot be used together")
+	}
+	if (o.Approx || o.Spill) && (o.ByFile || o.NewSince != "") {
+		return errors.New("--by-file and --new-since cannot be used with --approx or --spill")
+	}
+
+	labels := o.Columns
+
+	switch {
+	case o.ByFile || o.NewSince != "":
+		return columnValuesByFile(files, labels, o)
+	case o.Approx:
+		return columnValuesApprox(files, labels, o)
+	case o.Spill:
+		return columnValuesSpill(files, labels, o)
+	}
+
 	uniq := map[string]struct{}{}
 	freq := map[string]int{}
+	err := collectValues(files, o, func(_ string, key string) {
+		if o.Mode == ValsUniq {
+			uniq[key] = struct{}{}
+		} else {
+			freq[key]++
+		}
+	})
+	if err != nil {
+		return err
+	}
 
-	// Check for incompatible options
-	if !o.Filter.IsEmpty() && o.FixedStart > 0 && o.FixedEnd >= o.FixedStart {
-		return errors.New("--when and --fixed-width cannot be used together")
+	switch o.Mode {
+	case ValsUniq:
+		out := make([]string, 0, len(uniq))
+		for v := range uniq {
+			out = append(out, v)
+		}
+		sort.Strings(out)
+		i := 0
+		printUniqValues(labels, func() (string, bool) {
+			if i == len(out) {
+				return "", false
+			}
+			i++
+			return out[i-1], true
+		}, 0)
+	case ValsFreq:
+		out := make([]valueCount, 0, len(freq))
+		var total int64
+		for v, c := range freq {
+			out = append(out, valueCount{v, int64(c)})
+			total += int64(c)
+		}
+		sortValueCounts(out)
+		printFreqTable(labels, sliceCounts(out), freqTotals{rows: total, distinct: uint64(len(out))}, o)
 	}
+	return nil
+}
 
-	for _, path := range files {
-		if o.FixedStart > 0 && o.FixedEnd >= o.FixedStart {
-			if err := scanFixed(path, o, uniq, freq); err != nil {
-				fmt.Fprintf(os.Stderr, "[WARN] %s: %v\n", path, err)
+// collectValues calls fn with the key for every counted row: the values of
+// o.Columns joined by keySep, with empty values replaced by o.NullToken
+func collectValues(files []string, o ValsOpts, fn func(path, key string)) error {
+	return scanColumns(files, o.Columns, o.Fixed, o.Filter, o.Config, func(path string, vals []string) {
+		for i, v := range vals {
+			if v == "" && o.NullToken != "" {
+				vals[i] = o.NullToken
 			}
-			continue
 		}
+		fn(path, strings.Join(vals, keySep))
+	})
+}
+
+// printUniqValues prints values from next, one per line, or as a table
+// when several columns are combined; flushEvery bounds how many rows the
+// table buffers for alignment (0 for all)
+func printUniqValues(labels []string, next func() (string, bool), flushEvery int) {
+	if len(labels) == 1 {
+		w := bufio.NewWriter(os.Stdout)
+		for v, ok := next(); ok; v, ok = next() {
+			w.WriteString(v)
+			w.WriteByte('\n')
+		}
+		w.Flush()
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(labels, "\t"))
+	n := 0
+	for v, ok := next(); ok; v, ok = next() {
+		fmt.Fprintln(w, strings.ReplaceAll(v, keySep, "\t"))
+		if n++; flushEvery > 0 && n%flushEvery == 0 {
+			w.Flush()
+		}
+	}
+	w.Flush()
+}
+
+// keySep joins the values of several columns into one map key
+const keySep = "\x1f"
+
+// SplitColumns turns a COL argument into column names: the whole argument
+// when a fixed-width field or some file's header has a column by exactly
+// that name, so names containing commas still work, otherwise its
+// comma-separated parts
+func SplitColumns(files []string, spec string, fixed []FixedField, cfg *core.Config) []string {
+	whole := strings.TrimSpace(spec)
+	if strings.Contains(whole, ",") {
+		for _, fd := range fixed {
+			if fd.Name == whole {
+				return []string{whole}
+			}
+		}
+		if len(fixed) == 0 && !cfg.NoHeader {
+			for _, path := range files {
+				if hdr, err := readHeader(path, cfg); err == nil && slices.Contains(hdr, whole) {
+					return []string{whole}
+				}
+			}
+		}
+	}
+
+	var cols []string
+	for _, p := range strings.Split(spec, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			cols = append(cols, p)
+		}
+	}
+	return cols
+}
 
-		rc, err := core.OpenWithEncoding(path, o.Config.Encoding)
+// scanColumns calls fn with the trimmed values of cols for every row that
+// matches filter, resolving the columns in each file's header, or among the
+// fixed-width fields when fixed is set; rows too short to contain every
+// column are skipped, and fn may modify vals
+func scanColumns(files []string, cols []string, fixed []FixedField, filter Filter, cfg *core.Config, fn func(path string, vals []string)) error {
+	idx := make([]int, len(cols))
+	vals := make([]string, len(cols))
+	// Files with a header, and how many of them had every column
+	headed, resolved := 0, 0
+
+	for _, path := range files {
+		rc, err := core.OpenWithEncoding(path, cfg.Encoding)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "[WARN] cannot read %s: %v\n", path, err)
 			continue
 		}
-		cr := core.NewCSVReader(rc, o.Config.Delim, o.Config.LazyQuotes)
+		// Fixed-width fields are always addressed by name
+		var cr rowReader = core.NewCSVReader(rc, cfg.Delim, cfg.LazyQuotes)
+		var fr *fixedReader
+		noHeader := cfg.NoHeader
+		if len(fixed) > 0 {
+			fr = newFixedReader(rc, fixed)
+			cr = fr
+			noHeader = false
+		}
 
-		var idx int
-		var hdr []string
 		var resolvedFilter ResolvedFilter
 
-		if o.Config.NoHeader {
-			idx, err = strconv.Atoi(o.Column)
-			if err != nil || idx < 0 {
-				rc.Close()
-				return fmt.Errorf("--no-header requires numeric column index, got %q", o.Column)
+		if noHeader {
+			for i, c := range cols {
+				idx[i], err = parseIndex(c)
+				if err != nil {
+					rc.Close()
+					return fmt.Errorf("--no-header requires numeric column index, got %q", c)
+				}
 			}
 			// Resolve filter with no header
-			if !o.Filter.IsEmpty() {
-				resolvedFilter, err = o.Filter.Resolve(nil, true)
+			if !filter.IsEmpty() {
+				resolvedFilter, err = filter.Resolve(nil, true)
 				if err != nil {
 					rc.Close()
 					return err
 				}
 			}
 		} else {
-			hdr, err = cr.Read()
+			hdr, err := cr.Read()
 			if err == io.EOF {
 				fmt.Fprintf(os.Stderr, "[WARN] %s is empty\n", path)
 				rc.Close()
@@ -94,21 +247,24 @@ func ColumnValues(files []string, o ValsOpts) error {
 				rc.Close()
 				continue
 			}
-			idx = -1
-			for i, h := range hdr {
-				if h == o.Column {
-					idx = i
+			headed++
+			missing := false
+			for i, c := range cols {
+				idx[i], err = resolveHeaderIndex(hdr, c)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "[WARN] %s: %v\n", path, err)
+					missing = true
 					break
 				}
 			}
-			if idx < 0 {
-				fmt.Fprintf(os.Stderr, "[WARN] %s: header %q not found\n", path, o.Column)
+			if missing {
 				rc.Close()
 				continue
 			}
+			resolved++
 			// Resolve filter with header
-			if !o.Filter.IsEmpty() {
-				resolvedFilter, err = o.Filter.Resolve(hdr, false)
+			if !filter.IsEmpty() {
+				resolvedFilter, err = filter.Resolve(hdr, false)
 				if err != nil {
 					fmt.Fprintf(os.Stderr, "[WARN] %s: %v\n", path, err)
 					rc.Close()
@@ -117,6 +273,7 @@ func ColumnValues(files []string, o ValsOpts) error {
 			}
 		}
 
+	rows:
 		for {
 			rec, err := cr.Read()
 			if err == io.EOF {
@@ -126,83 +283,106 @@ func ColumnValues(files []string, o ValsOpts) error {
 				fmt.Fprintf(os.Stderr, "[WARN] %s: %v\n", path, err)
 				break
 			}
-			if idx >= len(rec) {
-				continue
-			}
 			if !resolvedFilter.Match(rec) {
 				continue
 			}
-			v := strings.TrimSpace(rec[idx])
-			if v == "" && o.NullToken != "" {
-				v = o.NullToken
-			}
-			if o.Mode == ValsUniq {
-				uniq[v] = struct{}{}
-			} else {
-				freq[v]++
+			for i, j := range idx {
+				// Rows too short for a column are skipped, whatever the
+				// order the columns were given in
+				if j >= len(rec) || (fr != nil && !fr.reaches(j)) {
+					continue rows
+				}
+				vals[i] = strings.TrimSpace(rec[j])
 			}
+			fn(path, vals)
 		}
 		rc.Close()
 	}
-
-	switch o.Mode {
-	case ValsUniq:
-		out := make([]string, 0, len(uniq))
-		for v := range uniq {
-			out = append(out, v)
-		}
-		sort.Strings(out)
-		for _, v := range out {
-			fmt.Println(v)
-		}
-	case ValsFreq:
-		type pair struct {
-			v string
-			c int
-		}
-		out := make([]pair, 0, len(freq))
-		for v, c := range freq {
-			out = append(out, pair{v, c})
-		}
-		sort.Slice(out, func(i, j int) bool {
-			if out[i].c == out[j].c {
-				return out[i].v < out[j].v
-			}
-			return out[i].c > out[j].c
-		})
-		for _, p := range out {
-			fmt.Printf("%-30s %d\n", p.v, p.c)
-		}
+	if headed > 0 && resolved == 0 {
+		return fmt.Errorf("no file has column(s) %s", strings.Join(cols, ", "))
 	}
 	return nil
 }
 
-func scanFixed(path string, o ValsOpts, uniq map[string]struct{}, freq map[string]int) error {
-	f, err := os.Open(path)
-	if err != nil {
-		return err
+// freqTotals describes all counted values, including those not shown
+// Approx marks counts as estimates; Overcount bounds how far each shown
+// count may exceed the true count
+type freqTotals struct {
+	rows      int64
+	distinct  uint64
+	approx    bool
+	overcount int64
+	flush     int
+}
+
+// printFreqTable prints value counts from next, in descending count order,
+// applying Top and MinCount; values left out are summed into an other row
+// Pct adds percentage and cumulative percentage columns and Totals a total
+// row; values of several columns (joined by keySep) get a column each
+// A single column with none of these options keeps the plain value/count
+// listing
+func printFreqTable(labels []string, next func() (valueCount, bool), t freqTotals, o ValsOpts) {
+	if t.distinct == 0 {
+		return
 	}
-	defer f.Close()
-	start := o.FixedStart - 1
-	width := o.FixedEnd - o.FixedStart + 1
-	s := bufio.NewScanner(f)
-	for s.Scan() {
-		line := s.Text()
-		if start >= len(line) {
-			continue
+
+	approx := ""
+	if t.approx {
+		approx = "~"
+	}
+
+	if len(labels) == 1 && o.Top == 0 && o.MinCount == 0 && !o.Pct && !o.Totals && !t.approx {
+		for vc, ok := next(); ok; vc, ok = next() {
+			fmt.Printf("%-30s %d\n", vc.value, vc.count)
 		}
+		return
+	}
 
-		end := min(start+width, len(line))
-		v := strings.TrimSpace(line[start:end])
-		if v == "" && o.NullToken != "" {
-			v = o.NullToken
+	pct := func(n int64) string {
+		if !o.Pct {
+			return ""
 		}
+		if t.rows == 0 {
+			return "\t-"
+		}
+		return "\t" + strconv.FormatFloat(float64(n)*100/float64(t.rows), 'f', 2, 64) + "%"
+	}
 
-		if o.Mode == ValsUniq {
-			uniq[v] = struct{}{}
-		} else {
-			freq[v]++
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	// Summary rows leave the remaining value columns blank
+	pad := strings.Repeat("\t", len(labels)-1)
+
+	fmt.Fprintf(w, "%s\tcount", strings.Join(labels, "\t"))
+	if o.Pct {
+		fmt.Fprint(w, "\tpercent\tcumulative")
+	}
+	fmt.Fprintln(w)
+	var cum int64
+	var shown uint64
+	for vc, ok := next(); ok; vc, ok = next() {
+		if o.MinCount > 0 && vc.count < int64(o.MinCount) {
+			break
 		}
+		if o.Top > 0 && shown == uint64(o.Top) {
+			break
+		}
+		cum += vc.count
+		shown++
+		fmt.Fprintf(w, "%s\t%s%d%s%s\n", strings.ReplaceAll(vc.value, keySep, "\t"), approx, vc.count, pct(vc.count), pct(cum))
+		if t.flush > 0 && shown%uint64(t.flush) == 0 {
+			w.Flush()
+		}
+	}
+	if t.distinct > shown {
+		other := max(t.rows-cum, 0)
+		fmt.Fprintf(w, "(other: %s%d values)%s\t%s%d%s%s\n", approx, t.distinct-shown, pad, approx, other, pct(other), pct(t.rows))
+	}
+	if o.Totals {
+		fmt.Fprintf(w, "(total: %s%d values)%s\t%d%s\n", approx, t.distinct, pad, t.rows, pct(t.rows))
+	}
+	w.Flush()
+
+	if t.approx {
+		fmt.Fprintf(os.Stderr, "[INFO] counts are streaming estimates (each may be high by up to %d); the number of values is a HyperLogLog estimate\n", t.overcount)
 	}
-	return s.Err()
 }
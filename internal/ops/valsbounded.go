@@ -0,0 +1,139 @@
+package ops
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// defaultApproxTop is how many values --approx shows when --top is unset
+const defaultApproxTop = 20
+
+// columnValuesApprox counts values exactly until o.MaxValues distinct values
+// are seen, then estimates the number of values with HyperLogLog and the most
+// frequent values with Space-Saving, in fixed memory
+func columnValuesApprox(files []string, labels []string, o ValsOpts) error {
+	top := o.Top
+	if top <= 0 {
+		top = defaultApproxTop
+	}
+	dc := newDistinctCounter(o.MaxValues, max(top*10, 1000))
+	var rows int64
+	err := collectValues(files, o, func(_ string, key string) {
+		dc.add(key)
+		rows++
+	})
+	if err != nil {
+		return err
+	}
+
+	if o.Mode == ValsUniq {
+		if dc.approximate() {
+			fmt.Printf("~%d distinct values\n", dc.distinct())
+			fmt.Fprintln(os.Stderr, "[INFO] too many values to list with --approx; the count is a HyperLogLog estimate (use --spill for an exact list)")
+			return nil
+		}
+		all := dc.top(0)
+		sort.Slice(all, func(i, j int) bool { return all[i].value < all[j].value })
+		printUniqValues(labels, sliceValues(all), 0)
+		return nil
+	}
+
+	var counts []valueCount
+	if dc.approximate() {
+		counts = dc.top(top)
+	} else {
+		counts = dc.top(0)
+	}
+	next := sliceCounts(counts)
+	printFreqTable(labels, next, freqTotals{
+		rows:      rows,
+		distinct:  dc.distinct(),
+		approx:    dc.approximate(),
+		overcount: dc.overcount(),
+	}, o)
+	return nil
+}
+
+// columnValuesSpill counts values exactly, holding at most o.MaxValues
+// distinct values in memory and sorting the rest through temporary files
+// under o.SpillDir
+func columnValuesSpill(files []string, labels []string, o ValsOpts) error {
+	sc, err := newSpillCounter(o.SpillDir, o.MaxValues)
+	if err != nil {
+		return err
+	}
+	defer sc.remove()
+
+	var rows int64
+	err = collectValues(files, o, func(_ string, key string) {
+		sc.add(key)
+		rows++
+	})
+	if err != nil {
+		return err
+	}
+
+	byVal, err := sc.sorted()
+	if err != nil {
+		return err
+	}
+	defer byVal.close()
+
+	// Large outputs are aligned in blocks so the table is not held in memory
+	const flushEvery = 10_000
+
+	if o.Mode == ValsUniq {
+		printUniqValues(labels, func() (string, bool) {
+			vc, ok := byVal.next()
+			return vc.value, ok
+		}, flushEvery)
+		return byVal.err
+	}
+
+	// Re-sort the merged counts by frequency for the table
+	byCount, err := newExternalSorter(o.SpillDir, o.MaxValues, byCountDesc)
+	if err != nil {
+		return err
+	}
+	defer byCount.remove()
+	var distinct uint64
+	for vc, ok := byVal.next(); ok; vc, ok = byVal.next() {
+		distinct++
+		if err := byCount.add(vc); err != nil {
+			return err
+		}
+	}
+	if byVal.err != nil {
+		return byVal.err
+	}
+
+	merged, err := byCount.merge(false)
+	if err != nil {
+		return err
+	}
+	defer merged.close()
+	printFreqTable(labels, merged.next, freqTotals{rows: rows, distinct: distinct, flush: flushEvery}, o)
+	return merged.err
+}
+
+// sliceCounts iterates over counts in order
+func sliceCounts(counts []valueCount) func() (valueCount, bool) {
+	i := 0
+	return func() (valueCount, bool) {
+		if i == len(counts) {
+			return valueCount{}, false
+		}
+		i++
+		return counts[i-1], true
+	}
+}
+
+// sliceValues iterates over the values of counts in order
+func sliceValues(counts []valueCount) func() (string, bool) {
+	next := sliceCounts(counts)
+	return func() (string, bool) {
+		vc, ok := next()
+		return vc.value, ok
+	}
+}
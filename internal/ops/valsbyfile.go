@@ -0,0 +1,128 @@
+package ops
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+// fileCounts holds one value's count in each file, in file order
+type fileCounts struct {
+	perFile []int64
+	total   int64
+	first   int
+}
+
+// columnValuesByFile counts values per file and prints a value × file
+// matrix (ByFile) and/or the values first seen after o.NewSince
+func columnValuesByFile(files []string, labels []string, o ValsOpts) error {
+	since := -1
+	if o.NewSince != "" {
+		since = indexOfFile(files, o.NewSince)
+		if since < 0 {
+			return fmt.Errorf("--new-since file %q is not among the input files", o.NewSince)
+		}
+	}
+
+	fileIdx := make(map[string]int, len(files))
+	for i, f := range files {
+		fileIdx[f] = i
+	}
+	counts := map[string]*fileCounts{}
+	add := func(path, key string, n int64) {
+		i := fileIdx[path]
+		c := counts[key]
+		if c == nil {
+			c = &fileCounts{perFile: make([]int64, len(files)), first: i}
+			counts[key] = c
+		}
+		c.perFile[i] += n
+		c.total += n
+	}
+
+	err := collectValues(files, o, func(path string, key string) {
+		add(path, key, 1)
+	})
+	if err != nil {
+		return err
+	}
+
+	order := make([]valueCount, 0, len(counts))
+	for v, c := range counts {
+		if o.ByFile || c.first > since {
+			order = append(order, valueCount{v, c.total})
+		}
+	}
+	sortValueCounts(order)
+	if o.MinCount > 0 {
+		n := 0
+		for n < len(order) && order[n].count >= int64(o.MinCount) {
+			n++
+		}
+		order = order[:n]
+	}
+	if o.Top > 0 && len(order) > o.Top {
+		order = order[:o.Top]
+	}
+
+	fmt.Println("Files:")
+	for i, f := range files {
+		fmt.Printf("  [%d] %s\n", i+1, f)
+	}
+	fmt.Println()
+
+	if !o.ByFile {
+		if len(order) == 0 {
+			fmt.Printf("No values first seen after [%d] %s\n", since+1, files[since])
+			return nil
+		}
+		fmt.Printf("Values first seen after [%d] %s:\n", since+1, files[since])
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "%s\tfirst seen\tcount\n", strings.Join(labels, "\t"))
+		for _, vc := range order {
+			c := counts[vc.value]
+			fmt.Fprintf(w, "%s\t[%d]\t%d\n", strings.ReplaceAll(vc.value, keySep, "\t"), c.first+1, c.total)
+		}
+		w.Flush()
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprint(w, strings.Join(labels, "\t"))
+	for i := range files {
+		fmt.Fprintf(w, "\t[%d]", i+1)
+	}
+	fmt.Fprintln(w, "\ttotal")
+
+	for _, vc := range order {
+		c := counts[vc.value]
+		fmt.Fprint(w, strings.ReplaceAll(vc.value, keySep, "\t"))
+		for _, n := range c.perFile {
+			fmt.Fprintf(w, "\t%d", n)
+		}
+		fmt.Fprintf(w, "\t%d", c.total)
+		if since >= 0 && c.first > since {
+			fmt.Fprintf(w, "\t← new in [%d]", c.first+1)
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+	return nil
+}
+
+// indexOfFile finds name in files by exact path, cleaned path, or base name
+func indexOfFile(files []string, name string) int {
+	for i, f := range files {
+		if f == name || filepath.Clean(f) == filepath.Clean(name) {
+			return i
+		}
+	}
+	for i, f := range files {
+		if filepath.Base(f) == name {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,87 @@
+package ops
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/c-a-ray/dkit/internal/core"
+)
+
+// XtabOpts configures a cross-tabulation of two columns
+// Empty cells are counted under NullToken, as in ColumnValues
+type XtabOpts struct {
+	RowColumn string
+	ColColumn string
+	NullToken string
+	Filter    Filter
+	Config    *core.Config
+}
+
+// CrossTab prints a contingency table counting rows for each pair of
+// RowColumn and ColColumn values, with row and column totals
+func CrossTab(files []string, o XtabOpts) error {
+	if len(files) == 0 {
+		return errors.New("no files")
+	}
+
+	cells := map[[2]string]int64{}
+	rowTotals := map[string]int64{}
+	colTotals := map[string]int64{}
+	var total int64
+
+	err := scanColumns(files, []string{o.RowColumn, o.ColColumn}, nil, o.Filter, o.Config, func(_ string, vals []string) {
+		for i, v := range vals {
+			if v == "" && o.NullToken != "" {
+				vals[i] = o.NullToken
+			}
+		}
+		cells[[2]string{vals[0], vals[1]}]++
+		rowTotals[vals[0]]++
+		colTotals[vals[1]]++
+		total++
+	})
+	if err != nil {
+		return err
+	}
+	if total == 0 {
+		return nil
+	}
+
+	rows := sortedKeys(rowTotals)
+	cols := sortedKeys(colTotals)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "%s \\ %s\t", o.RowColumn, o.ColColumn)
+	for _, c := range cols {
+		fmt.Fprintf(w, "%s\t", c)
+	}
+	fmt.Fprint(w, "total\t\n")
+
+	for _, r := range rows {
+		fmt.Fprintf(w, "%s\t", r)
+		for _, c := range cols {
+			fmt.Fprintf(w, "%d\t", cells[[2]string{r, c}])
+		}
+		fmt.Fprintf(w, "%d\t\n", rowTotals[r])
+	}
+
+	fmt.Fprint(w, "total\t")
+	for _, c := range cols {
+		fmt.Fprintf(w, "%d\t", colTotals[c])
+	}
+	fmt.Fprintf(w, "%d\t\n", total)
+	w.Flush()
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}